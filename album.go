@@ -1,18 +1,28 @@
 package spotify
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"net/url"
 	"path"
+	"sort"
 
 	"github.com/pkg/errors"
 )
 
+const maxAlbumsPerRequest = 20
+
 type Album struct {
 	Type string `json:"type"`
 	ID string `json:"id"`
 	URI string `json:"uri"`
 	Name string `json:"name"`
+	// AlbumType is album, single or compilation.
+	AlbumType string `json:"album_type,omitempty"`
+	// AlbumGroup is only set on an artist's albums, where appears_on
+	// means the artist is only a guest on the album.
+	AlbumGroup string `json:"album_group,omitempty"`
 	Artists []*Artist `json:"artists"`
 	Genres []string `json:"genres"`
 	ReleaseDate string `json:"release_date"`
@@ -20,24 +30,161 @@ type Album struct {
 	Popularity int `json:"popularity"`
 	Images []*Image `json:"images"`
 	Href string `json:"href"`
+	Label string `json:"label,omitempty"`
+	Copyrights []*Copyright `json:"copyrights,omitempty"`
+	TotalTracks int `json:"total_tracks,omitempty"`
+	ExternalIDs *ExternalIDs `json:"external_ids,omitempty"`
+	ExternalURLs map[string]string `json:"external_urls,omitempty"`
+	AvailableMarkets []string `json:"available_markets,omitempty"`
+	// Restrictions is only set when a market was given with WithMarket.
+	Restrictions *Restrictions `json:"restrictions,omitempty"`
+	// Tracks holds as many tracks as came with the album, which for a
+	// full album is the first page of them.  GetTracks gets the rest.
 	Tracks []*Track `json:"tracks"`
+	// tracksPage is the paging object the tracks came in, without its
+	// items, if they came in one.
+	tracksPage *PagingObject
 	c *SpotifyClient
 }
 
+// MarshalJSON writes tracks that came in a page back out as one, so that
+// GetTracks can still fetch the rest after a round trip.  Tracks that
+// point back at the album, by id since the receiver is a copy, are written
+// without it.
+func (alb Album) MarshalJSON() ([]byte, error) {
+	type albumAlias Album
+	tracks := make([]*Track, len(alb.Tracks))
+	for i, tr := range alb.Tracks {
+		if tr != nil && tr.Album != nil && tr.Album.ID == alb.ID {
+			cp := *tr
+			cp.Album = nil
+			tr = &cp
+		}
+		tracks[i] = tr
+	}
+	aux := &struct {
+		*albumAlias
+		Tracks interface{} `json:"tracks"`
+	}{albumAlias: (*albumAlias)(&alb)}
+	if alb.tracksPage != nil {
+		page := *alb.tracksPage
+		page.Items = make(TypedItems, len(tracks))
+		for i, tr := range tracks {
+			page.Items[i] = tr
+		}
+		aux.Tracks = &page
+	} else if alb.Tracks != nil {
+		aux.Tracks = tracks
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON accepts tracks either as a list or as the paging object
+// spotify embeds in full albums.
+func (alb *Album) UnmarshalJSON(data []byte) error {
+	type albumAlias Album
+	aux := &struct {
+		*albumAlias
+		Tracks json.RawMessage `json:"tracks"`
+	}{albumAlias: (*albumAlias)(alb)}
+	err := json.Unmarshal(data, aux)
+	if err != nil {
+		return err
+	}
+	alb.Tracks = nil
+	alb.tracksPage = nil
+	raw := bytes.TrimSpace(aux.Tracks)
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+	case raw[0] == '[':
+		err = json.Unmarshal(raw, &alb.Tracks)
+		if err != nil {
+			return errors.Wrap(err, "can't unmarshal album tracks")
+		}
+	default:
+		page := &PagingObject{}
+		err = json.Unmarshal(raw, page)
+		if err != nil {
+			return errors.Wrap(err, "can't unmarshal album tracks page")
+		}
+		alb.Tracks = []*Track{}
+		for _, item := range page.Items {
+			if tr, ok := item.(*Track); ok {
+				alb.Tracks = append(alb.Tracks, tr)
+			}
+		}
+		page.Items = nil
+		alb.tracksPage = page
+	}
+	return nil
+}
+
 func (c *SpotifyClient) SearchAlbum(albumArtist, name string) ([]*Album, error) {
+	return c.SearchAlbumContext(context.Background(), albumArtist, name)
+}
+
+func (c *SpotifyClient) SearchAlbumContext(ctx context.Context, albumArtist, name string) ([]*Album, error) {
 	query := fmt.Sprintf("album:\"%s\"", name)
 	if albumArtist != "" {
 		query += fmt.Sprintf(" artist:\"%s\"", albumArtist)
 	}
-	res, err := c.Search(query, "album")
+	res, err := c.SearchContext(ctx, query, "album")
 	if err != nil {
 		return nil, errors.Wrap(err, "can't search spotify for album " + name)
 	}
 	return res.Albums, nil
 }
 
+// GetAlbum gets an album by its spotify id.
+func (c *SpotifyClient) GetAlbum(id string) (*Album, error) {
+	return c.GetAlbumContext(context.Background(), id)
+}
+
+func (c *SpotifyClient) GetAlbumContext(ctx context.Context, id string) (*Album, error) {
+	if id == "" {
+		return nil, errors.New("no album id")
+	}
+	alb := &Album{}
+	err := c.client.getJSON(ctx, path.Join("albums", id), marketArgs(ctx), alb)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify album " + id)
+	}
+	c.addClientToAlbums(alb)
+	return alb, nil
+}
+
+// GetAlbums gets albums by their spotify ids, in the same order.
+func (c *SpotifyClient) GetAlbums(ids ...string) ([]*Album, error) {
+	return c.GetAlbumsContext(context.Background(), ids...)
+}
+
+func (c *SpotifyClient) GetAlbumsContext(ctx context.Context, ids ...string) ([]*Album, error) {
+	found, err := c.client.getSeveral(ctx, "albums", "albums", ids, maxAlbumsPerRequest, marketArgs(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify albums")
+	}
+	albs := make([]*Album, len(ids))
+	for i, id := range ids {
+		data, ok := found[id]
+		if !ok {
+			continue
+		}
+		alb := &Album{}
+		err = json.Unmarshal(data, alb)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal spotify album " + id)
+		}
+		albs[i] = alb
+	}
+	c.addClientToAlbums(albs...)
+	return albs, nil
+}
+
 func (c *SpotifyClient) addClientToAlbums(albums ...*Album) {
 	for _, alb := range albums {
+		if alb == nil {
+			continue
+		}
 		if alb.c == nil {
 			alb.c = c
 		}
@@ -47,23 +194,97 @@ func (c *SpotifyClient) addClientToAlbums(albums ...*Album) {
 }
 
 func (alb *Album) GetTracks() ([]*Track, error) {
-	if alb.Tracks != nil && len(alb.Tracks) > 0 {
+	return alb.GetTracksContext(context.Background())
+}
+
+// GetTracksContext returns all of the album's tracks, in disc and track
+// order.  If the album came with only the first page of them, the rest
+// are fetched starting from where that page left off.
+func (alb *Album) GetTracksContext(ctx context.Context) ([]*Track, error) {
+	if len(alb.Tracks) > 0 && (alb.tracksPage == nil || alb.tracksPage.NextHref == nil) {
+		alb.setTracksAlbum()
+		sortTracks(alb.Tracks)
 		return alb.Tracks, nil
 	}
 	rsrc := path.Join("albums", alb.ID, "tracks")
-	q := url.Values{}
+	q := marketArgs(ctx)
 	q.Set("limit", "50")
 	q.Set("offset", "0")
-	sr, err := alb.c.GetPaged(rsrc, q)
+	tracks := []*Track{}
+	if len(alb.Tracks) > 0 {
+		var err error
+		market := q.Get("market")
+		rsrc, q, err = nextPage(*alb.tracksPage.NextHref)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't get the rest of the tracks for album " + alb.ID)
+		}
+		// the album may have been fetched without the market
+		if market != "" {
+			q.Set("market", market)
+		}
+		tracks = append(tracks, alb.Tracks...)
+	}
+	sr, err := alb.c.GetPagedContext(ctx, rsrc, q)
 	if err != nil {
 		return nil, err
 	}
-	alb.c.addClientToTracks(sr.Tracks...)
-	for _, tr := range sr.Tracks {
-		if tr.Album == nil {
+	tracks = append(tracks, sr.Tracks...)
+	alb.c.addClientToTracks(tracks...)
+	sortTracks(tracks)
+	alb.Tracks = tracks
+	alb.tracksPage = nil
+	alb.setTracksAlbum()
+	return alb.Tracks, nil
+}
+
+// setTracksAlbum points tracks that came without an album, as tracks
+// embedded in an album do, back at the album.
+func (alb *Album) setTracksAlbum() {
+	for _, tr := range alb.Tracks {
+		if tr != nil && tr.Album == nil {
 			tr.Album = alb
 		}
 	}
-	alb.Tracks = sr.Tracks
-	return alb.Tracks, nil
+}
+
+// DiscCount returns the number of discs among the album's loaded tracks.
+func (alb *Album) DiscCount() int {
+	return len(alb.Discs())
+}
+
+// Discs groups the album's loaded tracks by disc, in disc order, with
+// each disc's tracks in track order.  Call GetTracks first to make sure
+// all of them are loaded.
+func (alb *Album) Discs() [][]*Track {
+	tracks := append([]*Track{}, alb.Tracks...)
+	sortTracks(tracks)
+	discs := [][]*Track{}
+	for i, tr := range tracks {
+		if i == 0 || tr.DiscNumber != tracks[i - 1].DiscNumber {
+			discs = append(discs, []*Track{})
+		}
+		discs[len(discs) - 1] = append(discs[len(discs) - 1], tr)
+	}
+	return discs
+}
+
+// sortTracks sorts tracks by disc, and by track number within each disc.
+func sortTracks(tracks []*Track) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if tracks[i].DiscNumber != tracks[j].DiscNumber {
+			return tracks[i].DiscNumber < tracks[j].DiscNumber
+		}
+		return tracks[i].TrackNumber < tracks[j].TrackNumber
+	})
+}
+
+// Disc returns the loaded tracks on disc n, counting from 1, in track
+// order.
+func (alb *Album) Disc(n int) []*Track {
+	for _, disc := range alb.Discs() {
+		if disc[0].DiscNumber == n {
+			return disc
+		}
+	}
+	return nil
 }
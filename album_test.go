@@ -0,0 +1,204 @@
+package spotify_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func TestAlbumTrackOrder(t *testing.T) {
+	data := `{
+		"id": "album1",
+		"type": "album",
+		"tracks": [
+			{"id": "d2t1", "disc_number": 2, "track_number": 1},
+			{"id": "d1t2", "disc_number": 1, "track_number": 2},
+			{"id": "d2t2", "disc_number": 2, "track_number": 2},
+			{"id": "d1t1", "disc_number": 1, "track_number": 1}
+		]
+	}`
+	alb := &spotify.Album{}
+	err := json.Unmarshal([]byte(data), alb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks, err := alb.GetTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"d1t1", "d1t2", "d2t1", "d2t2"}
+	if len(tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(tracks), len(want))
+	}
+	for i, tr := range tracks {
+		if tr.ID != want[i] {
+			t.Errorf("track %d is %s, want %s", i, tr.ID, want[i])
+		}
+		if tr.Album != alb {
+			t.Errorf("track %s doesn't point back at its album", tr.ID)
+		}
+	}
+	discs := alb.Discs()
+	if len(discs) != 2 || len(discs[0]) != 2 || len(discs[1]) != 2 {
+		t.Fatalf("got discs %v, want 2 discs of 2 tracks", discs)
+	}
+	if discs[1][0].ID != "d2t1" || alb.Disc(2)[1].ID != "d2t2" {
+		t.Errorf("disc 2 is %s, %s", discs[1][0].ID, discs[1][1].ID)
+	}
+}
+
+func TestLongAlbumTracks(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	alb := addLongAlbum(s, 120)
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := c.GetAlbum(alb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Tracks) != 50 || full.Tracks[0].Name != "Track 1.1" || full.Tracks[49].Name != "Track 1.50" {
+		t.Fatalf("got %d embedded tracks, want the first page of 50", len(full.Tracks))
+	}
+	tracks, err := full.GetTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 120 {
+		t.Fatalf("got %d tracks, want 120", len(tracks))
+	}
+	for i, tr := range tracks {
+		want := fmt.Sprintf("Track %d.%d", i / 60 + 1, i % 60 + 1)
+		if tr.Name != want {
+			t.Errorf("track %d is %s, want %s", i, tr.Name, want)
+		}
+		if tr.Album != full {
+			t.Errorf("track %s doesn't point back at its album", tr.Name)
+		}
+	}
+	// the embedded page is kept, so only the rest is fetched
+	pages := []string{}
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "GET /v1/albums/") {
+			pages = append(pages, req)
+		}
+	}
+	if len(pages) != 3 || !strings.Contains(pages[1], "offset=50") || !strings.Contains(pages[2], "offset=100") {
+		t.Errorf("got album requests %v, want the album and tracks from offsets 50 and 100", pages)
+	}
+	if full.DiscCount() != 2 || len(full.Disc(2)) != 60 {
+		t.Errorf("got %d discs with %d tracks on disc 2", full.DiscCount(), len(full.Disc(2)))
+	}
+}
+
+func TestMarshalAlbumValue(t *testing.T) {
+	alb := &spotify.Album{}
+	err := json.Unmarshal([]byte(albumPayload), alb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 120; i += 1 {
+		alb.Tracks = append(alb.Tracks, &spotify.Track{ID: fmt.Sprintf("track%d", i), TrackNumber: i + 1})
+	}
+	// a copy of the album, as tracks point at after a round trip through
+	// another struct, counts as the same album
+	cp := *alb
+	for i, tr := range alb.Tracks {
+		if i % 2 == 0 {
+			tr.Album = alb
+		} else {
+			tr.Album = &cp
+		}
+	}
+	byValue, err := json.Marshal(*alb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPointer, err := json.Marshal(alb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(byValue) != string(byPointer) {
+		t.Errorf("album marshaled by value differs from by pointer")
+	}
+	if len(byValue) > 64 * 1024 {
+		t.Errorf("marshaled album is %d bytes, want the tracks without their album", len(byValue))
+	}
+	var got struct {
+		Tracks struct {
+			Next *string `json:"next"`
+			Items []map[string]interface{} `json:"items"`
+		} `json:"tracks"`
+	}
+	err = json.Unmarshal(byValue, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tracks.Next == nil || len(got.Tracks.Items) != 120 {
+		t.Errorf("got %d tracks and next link %v, want the page kept", len(got.Tracks.Items), got.Tracks.Next)
+	}
+	for i, item := range got.Tracks.Items {
+		if _, ok := item["album"]; ok {
+			t.Errorf("track %d was written with its album", i)
+		}
+	}
+}
+
+func TestMarket(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	alb := addLongAlbum(s, 60)
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := spotify.WithMarket(context.Background(), "US")
+	_, err = c.GetTrackContext(ctx, alb.Tracks[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTracksContext(ctx, alb.Tracks[0].ID, alb.Tracks[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetAlbumsContext(ctx, alb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := c.GetAlbumContext(ctx, alb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = full.GetTracksContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetArtistsContext(ctx, alb.Artists[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range s.Requests() {
+		if !strings.HasPrefix(req, "GET ") {
+			continue
+		}
+		u, err := url.Parse(strings.TrimPrefix(req, "GET "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "US"
+		if strings.HasPrefix(u.Path, "/v1/artists") {
+			want = ""
+		}
+		if u.Query().Get("market") != want {
+			t.Errorf("%s was sent with market %q, want %q", req, u.Query().Get("market"), want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// AudioAnalysis is spotify's low level analysis of a track's structure
+// and sound.  All times are in seconds from the start of the track.  Each
+// list of intervals is in time order.
+type AudioAnalysis struct {
+	Meta *AnalysisMeta `json:"meta"`
+	Track *AnalysisTrack `json:"track"`
+	Bars []*TimeInterval `json:"bars"`
+	Beats []*TimeInterval `json:"beats"`
+	Tatums []*TimeInterval `json:"tatums"`
+	Sections []*Section `json:"sections"`
+	Segments []*Segment `json:"segments"`
+}
+
+type AnalysisMeta struct {
+	AnalyzerVersion string `json:"analyzer_version"`
+	Platform string `json:"platform"`
+	DetailedStatus string `json:"detailed_status"`
+	StatusCode int `json:"status_code"`
+	Timestamp int64 `json:"timestamp"`
+	AnalysisTime float64 `json:"analysis_time"`
+	InputProcess string `json:"input_process"`
+}
+
+// AnalysisTrack summarizes the whole track.  Key, mode, tempo and time
+// signature are as in AudioFeatures, each with a confidence from 0 to 1.
+type AnalysisTrack struct {
+	NumSamples int `json:"num_samples"`
+	Duration float64 `json:"duration"`
+	SampleMD5 string `json:"sample_md5"`
+	OffsetSeconds float64 `json:"offset_seconds"`
+	WindowSeconds float64 `json:"window_seconds"`
+	AnalysisSampleRate int `json:"analysis_sample_rate"`
+	AnalysisChannels int `json:"analysis_channels"`
+	EndOfFadeIn float64 `json:"end_of_fade_in"`
+	StartOfFadeOut float64 `json:"start_of_fade_out"`
+	Loudness float64 `json:"loudness"`
+	Tempo float64 `json:"tempo"`
+	TempoConfidence float64 `json:"tempo_confidence"`
+	TimeSignature int `json:"time_signature"`
+	TimeSignatureConfidence float64 `json:"time_signature_confidence"`
+	Key int `json:"key"`
+	KeyConfidence float64 `json:"key_confidence"`
+	Mode int `json:"mode"`
+	ModeConfidence float64 `json:"mode_confidence"`
+	CodeString string `json:"codestring"`
+	CodeVersion float64 `json:"code_version"`
+	EchoprintString string `json:"echoprintstring"`
+	EchoprintVersion float64 `json:"echoprint_version"`
+	SynchString string `json:"synchstring"`
+	SynchVersion float64 `json:"synch_version"`
+	RhythmString string `json:"rhythmstring"`
+	RhythmVersion float64 `json:"rhythm_version"`
+}
+
+// TimeInterval is a bar, beat or tatum.
+type TimeInterval struct {
+	Start float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (ti *TimeInterval) End() float64 {
+	return ti.Start + ti.Duration
+}
+
+// Section is a large part of a track, such as a verse or chorus, with
+// its own key, mode, tempo and time signature.
+type Section struct {
+	TimeInterval
+	Loudness float64 `json:"loudness"`
+	Tempo float64 `json:"tempo"`
+	TempoConfidence float64 `json:"tempo_confidence"`
+	Key int `json:"key"`
+	KeyConfidence float64 `json:"key_confidence"`
+	Mode int `json:"mode"`
+	ModeConfidence float64 `json:"mode_confidence"`
+	TimeSignature int `json:"time_signature"`
+	TimeSignatureConfidence float64 `json:"time_signature_confidence"`
+}
+
+// Segment is a short stretch of roughly uniform sound.  Pitches holds the
+// strength of each of the 12 pitch classes, from C to B, between 0 and 1,
+// and Timbre holds 12 unbounded timbre coefficients.  Loudness values are
+// in dB, and LoudnessMaxTime is the offset of the peak from Start.
+type Segment struct {
+	TimeInterval
+	LoudnessStart float64 `json:"loudness_start"`
+	LoudnessMax float64 `json:"loudness_max"`
+	LoudnessMaxTime float64 `json:"loudness_max_time"`
+	LoudnessEnd float64 `json:"loudness_end"`
+	Pitches []float64 `json:"pitches"`
+	Timbre []float64 `json:"timbre"`
+}
+
+func (tr *Track) GetAudioAnalysis() (*AudioAnalysis, error) {
+	return tr.GetAudioAnalysisContext(context.Background())
+}
+
+func (tr *Track) GetAudioAnalysisContext(ctx context.Context) (*AudioAnalysis, error) {
+	aa := &AudioAnalysis{}
+	err := tr.c.client.getJSON(ctx, path.Join("audio-analysis", tr.ID), url.Values{}, aa)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get audio analysis for track " + tr.ID)
+	}
+	return aa, nil
+}
+
+// intervalsBetween returns the indexes of the first interval starting at
+// or after start and the first starting at or after end, given n
+// intervals in time order.
+func intervalsBetween(n int, startAt func(i int) float64, start, end float64) (int, int) {
+	i := sort.Search(n, func(i int) bool { return startAt(i) >= start })
+	j := sort.Search(n, func(i int) bool { return startAt(i) >= end })
+	if j < i {
+		j = i
+	}
+	return i, j
+}
+
+// intervalAt returns the index of the interval containing t, or -1, given
+// n intervals in time order.
+func intervalAt(n int, interval func(i int) *TimeInterval, t float64) int {
+	i := sort.Search(n, func(i int) bool { return interval(i).Start > t }) - 1
+	if i < 0 || t >= interval(i).End() {
+		return -1
+	}
+	return i
+}
+
+// BarsBetween returns the bars starting at or after start and before end.
+func (aa *AudioAnalysis) BarsBetween(start, end float64) []*TimeInterval {
+	i, j := intervalsBetween(len(aa.Bars), func(i int) float64 { return aa.Bars[i].Start }, start, end)
+	return aa.Bars[i:j]
+}
+
+// BeatsBetween returns the beats starting at or after start and before
+// end.
+func (aa *AudioAnalysis) BeatsBetween(start, end float64) []*TimeInterval {
+	i, j := intervalsBetween(len(aa.Beats), func(i int) float64 { return aa.Beats[i].Start }, start, end)
+	return aa.Beats[i:j]
+}
+
+// TatumsBetween returns the tatums starting at or after start and before
+// end.
+func (aa *AudioAnalysis) TatumsBetween(start, end float64) []*TimeInterval {
+	i, j := intervalsBetween(len(aa.Tatums), func(i int) float64 { return aa.Tatums[i].Start }, start, end)
+	return aa.Tatums[i:j]
+}
+
+// SegmentsBetween returns the segments starting at or after start and
+// before end.
+func (aa *AudioAnalysis) SegmentsBetween(start, end float64) []*Segment {
+	i, j := intervalsBetween(len(aa.Segments), func(i int) float64 { return aa.Segments[i].Start }, start, end)
+	return aa.Segments[i:j]
+}
+
+// BarAt returns the bar playing at time t, or nil if there isn't one.
+func (aa *AudioAnalysis) BarAt(t float64) *TimeInterval {
+	i := intervalAt(len(aa.Bars), func(i int) *TimeInterval { return aa.Bars[i] }, t)
+	if i < 0 {
+		return nil
+	}
+	return aa.Bars[i]
+}
+
+// BeatAt returns the beat playing at time t, or nil if there isn't one.
+func (aa *AudioAnalysis) BeatAt(t float64) *TimeInterval {
+	i := intervalAt(len(aa.Beats), func(i int) *TimeInterval { return aa.Beats[i] }, t)
+	if i < 0 {
+		return nil
+	}
+	return aa.Beats[i]
+}
+
+// SectionAt returns the section playing at time t, or nil if there isn't
+// one.
+func (aa *AudioAnalysis) SectionAt(t float64) *Section {
+	i := intervalAt(len(aa.Sections), func(i int) *TimeInterval { return &aa.Sections[i].TimeInterval }, t)
+	if i < 0 {
+		return nil
+	}
+	return aa.Sections[i]
+}
+
+// SegmentAt returns the segment playing at time t, or nil if there isn't
+// one.
+func (aa *AudioAnalysis) SegmentAt(t float64) *Segment {
+	i := intervalAt(len(aa.Segments), func(i int) *TimeInterval { return &aa.Segments[i].TimeInterval }, t)
+	if i < 0 {
+		return nil
+	}
+	return aa.Segments[i]
+}
@@ -0,0 +1,121 @@
+package spotify
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testAnalysis has the same intervals, [0, 2), [2, 4) and after a gap
+// [5, 7), for every kind.
+func testAnalysis() *AudioAnalysis {
+	aa := &AudioAnalysis{}
+	for _, iv := range [][2]float64{{0, 2}, {2, 2}, {5, 2}} {
+		ti := TimeInterval{Start: iv[0], Duration: iv[1]}
+		for _, list := range []*[]*TimeInterval{&aa.Bars, &aa.Beats, &aa.Tatums} {
+			cp := ti
+			*list = append(*list, &cp)
+		}
+		aa.Sections = append(aa.Sections, &Section{TimeInterval: ti})
+		aa.Segments = append(aa.Segments, &Segment{TimeInterval: ti})
+	}
+	return aa
+}
+
+func TestIntervalAt(t *testing.T) {
+	aa := testAnalysis()
+	tests := map[string]struct {
+		t float64
+		want int
+	}{
+		"at the first start": {0, 0},
+		"inside": {1.5, 0},
+		"at an end and the next start": {2, 1},
+		"at an end before a gap": {4, -1},
+		"in a gap": {4.5, -1},
+		"at a start after a gap": {5, 2},
+		"before the first": {-1, -1},
+		"at the last end": {7, -1},
+		"after the last": {8, -1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := intervalAt(len(aa.Bars), func(i int) *TimeInterval { return aa.Bars[i] }, test.t)
+			if i != test.want {
+				t.Fatalf("intervalAt(%g) = %d, want %d", test.t, i, test.want)
+			}
+			var want *TimeInterval
+			if i >= 0 {
+				want = aa.Bars[i]
+			}
+			got := map[string]*TimeInterval{
+				"BarAt": aa.BarAt(test.t),
+				"BeatAt": aa.BeatAt(test.t),
+			}
+			if sec := aa.SectionAt(test.t); sec != nil {
+				got["SectionAt"] = &sec.TimeInterval
+			} else {
+				got["SectionAt"] = nil
+			}
+			if seg := aa.SegmentAt(test.t); seg != nil {
+				got["SegmentAt"] = &seg.TimeInterval
+			} else {
+				got["SegmentAt"] = nil
+			}
+			for method, ti := range got {
+				if (ti == nil) != (want == nil) || (ti != nil && ti.Start != want.Start) {
+					t.Errorf("%s(%g) = %v, want %v", method, test.t, ti, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIntervalsBetween(t *testing.T) {
+	aa := testAnalysis()
+	tests := map[string]struct {
+		start, end float64
+		i, j int
+	}{
+		"from the first start": {0, 4, 0, 2},
+		"from an end": {2, 5, 1, 2},
+		"end at a start": {0, 5, 0, 2},
+		"from a gap": {4.5, 10, 2, 3},
+		"inside an interval": {1, 5.5, 1, 3},
+		"before the first": {-5, -1, 0, 0},
+		"after the last": {8, 10, 3, 3},
+		"start after end": {5, 2, 2, 2},
+		"empty range": {2, 2, 1, 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i, j := intervalsBetween(len(aa.Bars), func(i int) float64 { return aa.Bars[i].Start }, test.start, test.end)
+			if i != test.i || j != test.j {
+				t.Fatalf("intervalsBetween(%g, %g) = %d, %d, want %d, %d", test.start, test.end, i, j, test.i, test.j)
+			}
+			want := fmt.Sprint(starts(aa.Bars[i:j]))
+			got := map[string][]float64{
+				"BarsBetween": starts(aa.BarsBetween(test.start, test.end)),
+				"BeatsBetween": starts(aa.BeatsBetween(test.start, test.end)),
+				"TatumsBetween": starts(aa.TatumsBetween(test.start, test.end)),
+			}
+			segs := []*TimeInterval{}
+			for _, seg := range aa.SegmentsBetween(test.start, test.end) {
+				segs = append(segs, &seg.TimeInterval)
+			}
+			got["SegmentsBetween"] = starts(segs)
+			for method, s := range got {
+				if fmt.Sprint(s) != want {
+					t.Errorf("%s(%g, %g) starts at %v, want %s", method, test.start, test.end, s, want)
+				}
+			}
+		})
+	}
+}
+
+func starts(intervals []*TimeInterval) []float64 {
+	s := make([]float64, len(intervals))
+	for i, ti := range intervals {
+		s[i] = ti.Start
+	}
+	return s
+}
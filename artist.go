@@ -1,9 +1,9 @@
 package spotify
 
 import (
-	//"log"
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	//"log"
 	"net/url"
 	"path"
 	"sort"
@@ -12,6 +12,8 @@ import (
 )
 
 
+const maxArtistsPerRequest = 50
+
 type Artist struct {
 	ID string `json:"id"`
 	Name string `json:"name"`
@@ -27,12 +29,16 @@ type Artist struct {
 }
 
 func (art *Artist) GetImage(c *SpotifyClient) (img []byte, ct string, err error) {
+	return art.GetImageContext(context.Background(), c)
+}
+
+func (art *Artist) GetImageContext(ctx context.Context, c *SpotifyClient) (img []byte, ct string, err error) {
 	if len(art.Images) == 0 {
 		return nil, "", nil
 	}
 	sort.Sort(SortableImages(art.Images))
 	for _, im := range art.Images {
-		img, ct, err = im.Get(c)
+		img, ct, err = im.GetContext(ctx, c)
 		if err == nil {
 			return img, ct, nil
 		}
@@ -41,7 +47,11 @@ func (art *Artist) GetImage(c *SpotifyClient) (img []byte, ct string, err error)
 }
 
 func (c *SpotifyClient) SearchArtist(name string) ([]*Artist, error) {
-	res, err := c.Search(name, "artist")
+	return c.SearchArtistContext(context.Background(), name)
+}
+
+func (c *SpotifyClient) SearchArtistContext(ctx context.Context, name string) ([]*Artist, error) {
+	res, err := c.SearchContext(ctx, name, "artist")
 	if err != nil {
 		return nil, errors.Wrap(err, "can't search spotify for artist " + name)
 	}
@@ -49,14 +59,65 @@ func (c *SpotifyClient) SearchArtist(name string) ([]*Artist, error) {
 	return res.Artists, nil
 }
 
+// GetArtist gets an artist by its spotify id.
+func (c *SpotifyClient) GetArtist(id string) (*Artist, error) {
+	return c.GetArtistContext(context.Background(), id)
+}
+
+func (c *SpotifyClient) GetArtistContext(ctx context.Context, id string) (*Artist, error) {
+	if id == "" {
+		return nil, errors.New("no artist id")
+	}
+	art := &Artist{}
+	err := c.client.getJSON(ctx, path.Join("artists", id), url.Values{}, art)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify artist " + id)
+	}
+	c.addClientToArtists(art)
+	return art, nil
+}
+
+// GetArtists gets artists by their spotify ids, in the same order.
+func (c *SpotifyClient) GetArtists(ids ...string) ([]*Artist, error) {
+	return c.GetArtistsContext(context.Background(), ids...)
+}
+
+func (c *SpotifyClient) GetArtistsContext(ctx context.Context, ids ...string) ([]*Artist, error) {
+	found, err := c.client.getSeveral(ctx, "artists", "artists", ids, maxArtistsPerRequest, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify artists")
+	}
+	arts := make([]*Artist, len(ids))
+	for i, id := range ids {
+		data, ok := found[id]
+		if !ok {
+			continue
+		}
+		art := &Artist{}
+		err = json.Unmarshal(data, art)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal spotify artist " + id)
+		}
+		arts[i] = art
+	}
+	c.addClientToArtists(arts...)
+	return arts, nil
+}
+
 func (c *SpotifyClient) addClientToArtists(artists ...*Artist) {
 	for _, art := range artists {
-		art.c = c
+		if art != nil {
+			art.c = c
+		}
 	}
 }
 
 func (c *SpotifyClient) GetArtistImage(name string) (img []byte, ct string, err error) {
-	arts, err := c.SearchArtist(name)
+	return c.GetArtistImageContext(context.Background(), name)
+}
+
+func (c *SpotifyClient) GetArtistImageContext(ctx context.Context, name string) (img []byte, ct string, err error) {
+	arts, err := c.SearchArtistContext(ctx, name)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "can't find artist " + name)
 	}
@@ -64,7 +125,7 @@ func (c *SpotifyClient) GetArtistImage(name string) (img []byte, ct string, err
 		return nil, "", errors.New("no such artist")
 	}
 	for _, art := range arts {
-		img, ct, err = art.GetImage(c)
+		img, ct, err = art.GetImageContext(ctx, c)
 		if err == nil && img != nil {
 			return img, ct, nil
 		}
@@ -73,11 +134,15 @@ func (c *SpotifyClient) GetArtistImage(name string) (img []byte, ct string, err
 }
 
 func (art *Artist) GetAlbums() ([]*Album, error) {
+	return art.GetAlbumsContext(context.Background())
+}
+
+func (art *Artist) GetAlbumsContext(ctx context.Context) ([]*Album, error) {
 	rsrc := path.Join("artists", art.ID, "albums")
 	q := url.Values{}
 	q.Set("limit", "50")
 	q.Set("offset", "0")
-	sr, err := art.c.GetPaged(rsrc, q)
+	sr, err := art.c.GetPagedContext(ctx, rsrc, q)
 	if err != nil {
 		return nil, err
 	}
@@ -86,21 +151,16 @@ func (art *Artist) GetAlbums() ([]*Album, error) {
 }
 
 func (art *Artist) GetRelated() ([]*Artist, error) {
+	return art.GetRelatedContext(context.Background())
+}
+
+func (art *Artist) GetRelatedContext(ctx context.Context) ([]*Artist, error) {
 	rsrc := path.Join("artists", art.ID, "related-artists")
 	q := url.Values{}
-	res, err := art.c.client.Get(rsrc, q)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
 	search := &SearchResult{}
-	err = json.Unmarshal(data, search)
+	err := art.c.client.getJSON(ctx, rsrc, q, search)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "can't get related artists for " + art.ID)
 	}
 	for _, x := range search.Artists {
 		x.c = art.c
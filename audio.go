@@ -0,0 +1,80 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const maxAudioFeaturesPerRequest = 100
+
+// AudioFeatures are spotify's measurements of a track, on the same scales
+// as the MixArgs used to ask for recommendations.
+type AudioFeatures struct {
+	Type string `json:"type"`
+	ID string `json:"id"`
+	URI string `json:"uri"`
+	TrackHref string `json:"track_href"`
+	AnalysisURL string `json:"analysis_url"`
+	Acousticness float64 `json:"acousticness"`
+	Danceability float64 `json:"danceability"`
+	DurationMS int `json:"duration_ms"`
+	Energy float64 `json:"energy"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	// Key is the pitch class of the track's key, with 0 for C, 1 for C#
+	// and so on, or -1 if no key was detected.
+	Key int `json:"key"`
+	Liveness float64 `json:"liveness"`
+	// Loudness is the average loudness in dB, typically between -60
+	// and 0.
+	Loudness float64 `json:"loudness"`
+	// Mode is 1 for major and 0 for minor.
+	Mode int `json:"mode"`
+	Speechiness float64 `json:"speechiness"`
+	Tempo float64 `json:"tempo"`
+	TimeSignature int `json:"time_signature"`
+	Valence float64 `json:"valence"`
+}
+
+func (tr *Track) GetAudioFeatures() (*AudioFeatures, error) {
+	return tr.GetAudioFeaturesContext(context.Background())
+}
+
+func (tr *Track) GetAudioFeaturesContext(ctx context.Context) (*AudioFeatures, error) {
+	af := &AudioFeatures{}
+	err := tr.c.client.getJSON(ctx, path.Join("audio-features", tr.ID), url.Values{}, af)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get audio features for track " + tr.ID)
+	}
+	return af, nil
+}
+
+// GetAudioFeatures gets the audio features of tracks by their spotify
+// ids, in the same order.
+func (c *SpotifyClient) GetAudioFeatures(ids ...string) ([]*AudioFeatures, error) {
+	return c.GetAudioFeaturesContext(context.Background(), ids...)
+}
+
+func (c *SpotifyClient) GetAudioFeaturesContext(ctx context.Context, ids ...string) ([]*AudioFeatures, error) {
+	found, err := c.client.getSeveral(ctx, "audio-features", "audio_features", ids, maxAudioFeaturesPerRequest, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify audio features")
+	}
+	features := make([]*AudioFeatures, len(ids))
+	for i, id := range ids {
+		data, ok := found[id]
+		if !ok {
+			continue
+		}
+		af := &AudioFeatures{}
+		err = json.Unmarshal(data, af)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal audio features for track " + id)
+		}
+		features[i] = af
+	}
+	return features, nil
+}
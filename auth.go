@@ -5,37 +5,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+const spotifyAccountsURL = "https://accounts.spotify.com/"
+
 type ClientAuth struct {
 	clientId string
 	clientSecret string
+	accountsURL string
 	token string
 	expires time.Time
+	mutex sync.RWMutex
+	flight tokenFlight
 	client *http.Client
+	log *logger
 }
 
 type SpotifyAuthData struct {
 	AccessToken string `json:"access_token"`
 	TokenType string `json:"token_type"`
 	TTL int `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope string `json:"scope,omitempty"`
 }
 
 func NewClientAuth(clientId, clientSecret string) (*ClientAuth, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+	return newClientAuth(clientId, clientSecret, spotifyAccountsURL, client, newLogger(nil, false))
+}
+
+func newClientAuth(clientId, clientSecret, accountsURL string, client *http.Client, log *logger) (*ClientAuth, error) {
 	c := &ClientAuth{
 		clientId: clientId,
 		clientSecret: clientSecret,
+		accountsURL: accountsURL,
 		token: "",
 		expires: time.Now().Add(-time.Second),
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
+		client: client,
+		log: log,
 	}
 	err := c.AuthIfNecessary()
 	if err != nil {
@@ -45,53 +60,150 @@ func NewClientAuth(clientId, clientSecret string) (*ClientAuth, error) {
 }
 
 func (c *ClientAuth) AuthenticateRequest(req *http.Request) error {
-	err := c.AuthIfNecessary()
+	token, err := c.accessToken()
 	if err != nil {
 		return errors.Wrap(err, "spotify auth failed")
 	}
-	log.Printf("%s %s", req.Method, req.URL)
-	log.Printf("Authorization: Bearer %s", c.token)
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	return nil
 }
 
 func (c *ClientAuth) AuthIfNecessary() error {
-	if c.token != "" && c.expires.After(time.Now().Add(time.Second)) {
+	_, err := c.accessToken()
+	return err
+}
+
+func (c *ClientAuth) currentToken() (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.token, c.token != "" && c.expires.After(time.Now().Add(time.Second))
+}
+
+// accessToken returns a valid token, fetching a new one if necessary.
+// Concurrent callers share a single request to the accounts service.
+func (c *ClientAuth) accessToken() (string, error) {
+	token, ok := c.currentToken()
+	if ok {
+		return token, nil
+	}
+	err := c.flight.Do(func() error {
+		if _, ok := c.currentToken(); ok {
+			return nil
+		}
+		c.mutex.Lock()
+		c.token = ""
+		c.mutex.Unlock()
+		q := url.Values{}
+		q.Set("grant_type", "client_credentials")
+		now := time.Now()
+		auth, err := requestToken(c.client, c.log, c.accountsURL, c.clientId, c.clientSecret, q)
+		if err != nil {
+			return err
+		}
+		expires := now.Add(time.Duration(auth.TTL - 1) * time.Second)
+		c.mutex.Lock()
+		c.token = auth.AccessToken
+		c.expires = expires
+		c.mutex.Unlock()
+		c.log.Debugf("spotify auth expires at %s", expires)
 		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	token, _ = c.currentToken()
+	return token, nil
+}
+
+func (c *ClientAuth) InvalidateToken(token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// tokenFlight collapses concurrent token requests into one.  While a
+// request is in flight, other callers wait for it and get its error.
+type tokenFlight struct {
+	mutex sync.Mutex
+	call *tokenCall
+}
+
+type tokenCall struct {
+	done chan struct{}
+	err error
+}
+
+func (f *tokenFlight) Do(fn func() error) error {
+	f.mutex.Lock()
+	if f.call != nil {
+		call := f.call
+		f.mutex.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	f.call = call
+	f.mutex.Unlock()
+	call.err = fn()
+	f.mutex.Lock()
+	f.call = nil
+	f.mutex.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// requestToken posts a form to the accounts service token endpoint.  If
+// clientSecret is empty, the client id is sent in the form body instead of
+// as basic auth, as required for PKCE clients.
+func requestToken(client *http.Client, log *logger, accountsURL, clientId, clientSecret string, q url.Values) (*SpotifyAuthData, error) {
+	tokenURL, err := accountsEndpoint(accountsURL, "api/token")
+	if err != nil {
+		return nil, err
+	}
+	if clientSecret == "" {
+		q.Set("client_id", clientId)
 	}
-	c.token = ""
-	q := url.Values{}
-	q.Set("grant_type", "client_credentials")
 	body := bytes.NewBufferString(q.Encode())
-	req, err := http.NewRequest(http.MethodPost, "https://accounts.spotify.com/api/token", body)
+	req, err := http.NewRequest(http.MethodPost, tokenURL, body)
 	if err != nil {
-		return errors.Wrap(err, "can't create spotify auth request")
+		return nil, errors.Wrap(err, "can't create spotify auth request")
+	}
+	if clientSecret != "" {
+		req.SetBasicAuth(clientId, clientSecret)
 	}
-	req.SetBasicAuth(c.clientId, c.clientSecret)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	now := time.Now()
-	res, err := c.client.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
-		return errors.Wrap(err, "can't execute spotify auth request")
+		return nil, errors.Wrap(err, "can't execute spotify auth request")
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		log.Println("error in auth response:", res.Status)
-		data, _ := ioutil.ReadAll(res.Body)
-		log.Println(string(data))
-		return errors.New(res.Status)
+		apiErr := newAPIError(res, "api/token")
+		log.Errorf("error in auth response: %s", apiErr)
+		return nil, apiErr
 	}
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return errors.Wrap(err, "can't read spotify auth response")
+		return nil, errors.Wrap(err, "can't read spotify auth response")
 	}
 	auth := &SpotifyAuthData{}
 	err = json.Unmarshal(data, auth)
 	if err != nil {
-		return errors.Wrap(err, "can't json unmarshal spotify auth response")
+		return nil, errors.Wrap(err, "can't json unmarshal spotify auth response")
 	}
-	c.token = auth.AccessToken
-	c.expires = now.Add(time.Duration(auth.TTL - 1) * time.Second)
-	log.Println("spotify auth expires at", c.expires)
-	return nil
+	return auth, nil
+}
+
+func accountsEndpoint(accountsURL, rsrc string) (string, error) {
+	base, err := url.Parse(accountsURL)
+	if err != nil {
+		return "", errors.Wrap(err, "can't parse spotify accounts url " + accountsURL)
+	}
+	u, err := base.Parse(rsrc)
+	if err != nil {
+		return "", errors.Wrap(err, "can't parse spotify accounts endpoint " + rsrc)
+	}
+	return u.String(), nil
 }
@@ -0,0 +1,132 @@
+package spotify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer is a fake token endpoint that counts requests and is slow
+// enough for concurrent callers to pile up behind the first one.
+type tokenServer struct {
+	*httptest.Server
+	posts int32
+	failing int32
+}
+
+func newTokenServer() *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&ts.posts, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.LoadInt32(&ts.failing) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"server_error","error_description":"try again"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token" + strconv.Itoa(int(n)),
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"refresh_token": "refresh",
+		})
+	}))
+	return ts
+}
+
+func (ts *tokenServer) count() int {
+	return int(atomic.LoadInt32(&ts.posts))
+}
+
+// concurrently calls fn from n goroutines at once and returns their
+// errors.
+func concurrently(n int, fn func() error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i += 1 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func checkShared(t *testing.T, errs []error, wantErr bool) {
+	for i, err := range errs {
+		if !wantErr && err != nil {
+			t.Fatalf("caller %d: %s", i, err)
+		}
+		if wantErr && err == nil {
+			t.Fatalf("caller %d: refresh didn't fail", i)
+		}
+		if err != errs[0] {
+			t.Fatalf("caller %d got %v, caller 0 got %v; want the same error", i, err, errs[0])
+		}
+	}
+}
+
+func TestClientAuthSingleFlight(t *testing.T) {
+	ts := newTokenServer()
+	defer ts.Close()
+	auth, err := newClientAuth("id", "secret", ts.URL + "/", ts.Client(), newLogger(NopLogger, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), false)
+	if ts.count() != 1 {
+		t.Fatalf("got %d token requests for one token, want 1", ts.count())
+	}
+	token, _ := auth.currentToken()
+	auth.InvalidateToken(token)
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), false)
+	if ts.count() != 2 {
+		t.Fatalf("got %d token requests after one expiry, want 2", ts.count())
+	}
+	token, _ = auth.currentToken()
+	auth.InvalidateToken(token)
+	atomic.StoreInt32(&ts.failing, 1)
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), true)
+	if ts.count() != 3 {
+		t.Fatalf("got %d token requests after a failed refresh, want 3", ts.count())
+	}
+}
+
+func TestUserAuthSingleFlight(t *testing.T) {
+	ts := newTokenServer()
+	defer ts.Close()
+	auth := NewUserAuth("id", "secret", "http://127.0.0.1/callback")
+	auth.SetAccountsURL(ts.URL + "/")
+	auth.SetHTTPClient(ts.Client())
+	auth.SetLogger(NopLogger, false)
+	auth.SetToken(&Token{AccessToken: "expired", RefreshToken: "refresh", Scope: ScopeUserReadPrivate, Expires: time.Now().Add(-time.Minute)})
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), false)
+	if ts.count() != 1 {
+		t.Fatalf("got %d token requests for one expiry, want 1", ts.count())
+	}
+	if auth.Token().Scope != ScopeUserReadPrivate {
+		t.Errorf("refresh without a scope changed it from %q to %q", ScopeUserReadPrivate, auth.Token().Scope)
+	}
+	auth.InvalidateToken(auth.Token().AccessToken)
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), false)
+	if ts.count() != 2 {
+		t.Fatalf("got %d token requests after two expiries, want 2", ts.count())
+	}
+	auth.InvalidateToken(auth.Token().AccessToken)
+	atomic.StoreInt32(&ts.failing, 1)
+	checkShared(t, concurrently(50, auth.AuthIfNecessary), true)
+	if ts.count() != 3 {
+		t.Fatalf("got %d token requests after a failed refresh, want 3", ts.count())
+	}
+}
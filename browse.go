@@ -1,15 +1,11 @@
 package spotify
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"context"
 	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/pkg/errors"
 )
@@ -29,6 +25,10 @@ type RecommendationResult struct {
 }
 
 func (c *SpotifyClient) Recommend(seeds ...interface{}) (*RecommendationResult, error) {
+	return c.RecommendContext(context.Background(), seeds...)
+}
+
+func (c *SpotifyClient) RecommendContext(ctx context.Context, seeds ...interface{}) (*RecommendationResult, error) {
 	seedArtists := []string{}
 	seedAlbums := []string{}
 	seedTracks := []string{}
@@ -36,11 +36,11 @@ func (c *SpotifyClient) Recommend(seeds ...interface{}) (*RecommendationResult,
 		switch seed := obj.(type) {
 		case *Artist:
 			if seed.ID == "" {
-				artists, err := c.SearchArtist(seed.Name)
+				artists, err := c.SearchArtistContext(ctx, seed.Name)
 				if err == nil && len(artists) > 0 {
 					seed = artists[0]
 				} else {
-					log.Println("no sporitfy artist for", seed.Name)
+					c.client.log.Infof("no spotify artist for %s", seed.Name)
 					continue
 				}
 			}
@@ -56,7 +56,7 @@ func (c *SpotifyClient) Recommend(seeds ...interface{}) (*RecommendationResult,
 				if err == nil && len(albums) > 0 {
 					seed = albums[0]
 				} else {
-					log.Println("no spotify album for", artist, seed.Name)
+					c.client.log.Infof("no spotify album for %s %s", artist, seed.Name)
 					continue
 				}
 			}
@@ -72,14 +72,14 @@ func (c *SpotifyClient) Recommend(seeds ...interface{}) (*RecommendationResult,
 				if seed.Album != nil {
 					album = seed.Album.Name
 				}
-				tracks, err := c.SearchTrack(album, artist, seed.Name)
+				tracks, err := c.SearchTrackContext(ctx, album, artist, seed.Name)
 				if len(tracks) == 0 {
-					tracks, err = c.SearchTrack("", artist, seed.Name)
+					tracks, err = c.SearchTrackContext(ctx, "", artist, seed.Name)
 				}
 				if err == nil && len(tracks) > 0 {
 					seed = tracks[0]
 				} else {
-					log.Println("no spotify track for", album, artist, seed.Name)
+					c.client.log.Infof("no spotify track for %s %s %s", album, artist, seed.Name)
 					continue
 				}
 			}
@@ -104,37 +104,12 @@ func (c *SpotifyClient) Recommend(seeds ...interface{}) (*RecommendationResult,
 		return nil, errors.New("no seeds")
 	}
 	q.Set("limit", "100")
-	rsrc := "recommendations"
-	for {
-		res, err := c.client.Get(rsrc, q)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't execute spotify search")
-		}
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			if res.StatusCode == http.StatusTooManyRequests {
-				wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
-				if err == nil {
-					log.Printf("API ratelimit; waiting %d seconds", wait)
-					time.Sleep(time.Duration(wait + 1) * time.Second)
-					continue
-				}
-			}
-			return nil, errors.New(res.Status)
-		}
-		data, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, errors.Wrap(err, "can't read spotify search response")
-		}
-		result := &RecommendationResult{}
-		err = json.Unmarshal(data, result)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't unmarshal spotify search response")
-		}
-		return result, nil
+	result := &RecommendationResult{}
+	err := c.client.getJSON(ctx, "recommendations", q, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify recommendations")
 	}
-	return nil, nil
+	return result, nil
 }
 
 type ArgRange struct {
@@ -191,74 +166,33 @@ type GenresResponse struct {
 }
 
 func (c *SpotifyClient) RecommendationGenres() ([]string, error) {
-	for {
-		res, err := c.client.Get("recommendations/available-genre-seeds", url.Values{})
-		if err != nil {
-			return nil, errors.Wrap(err, "can't execute spotify request")
-		}
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			if res.StatusCode == http.StatusTooManyRequests {
-				wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
-				if err == nil {
-					log.Printf("API ratelimit; waiting %d seconds", wait)
-					time.Sleep(time.Duration(wait + 1) * time.Second)
-					continue
-				}
-			}
-			return nil, errors.New(res.Status)
-		}
-		data, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, errors.Wrap(err, "can't read spotify search response")
-		}
-		result := &GenresResponse{}
-		err = json.Unmarshal(data, result)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't unmarshal spotify search response")
-		}
-		return result.Genres, nil
+	return c.RecommendationGenresContext(context.Background())
+}
+
+func (c *SpotifyClient) RecommendationGenresContext(ctx context.Context) ([]string, error) {
+	result := &GenresResponse{}
+	err := c.client.getJSON(ctx, "recommendations/available-genre-seeds", url.Values{}, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify genre seeds")
 	}
-	return nil, nil
+	return result.Genres, nil
 }
 
 func (c *SpotifyClient) Mix(genre string, args MixArgs) (*RecommendationResult, error) {
+	return c.MixContext(context.Background(), genre, args)
+}
+
+func (c *SpotifyClient) MixContext(ctx context.Context, genre string, args MixArgs) (*RecommendationResult, error) {
 	q := url.Values{}
 	q.Set("seed_genres", genre)
 	q.Set("market", "us")
 	q.Set("limit", "100")
 	args.AddQuery(q)
-	log.Println("mix:", q.Encode())
-	rsrc := "recommendations"
-	for {
-		res, err := c.client.Get(rsrc, q)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't execute spotify search")
-		}
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			if res.StatusCode == http.StatusTooManyRequests {
-				wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
-				if err == nil {
-					log.Printf("API ratelimit; waiting %d seconds", wait)
-					time.Sleep(time.Duration(wait + 1) * time.Second)
-					continue
-				}
-			}
-			return nil, errors.New(res.Status)
-		}
-		data, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, errors.Wrap(err, "can't read spotify search response")
-		}
-		result := &RecommendationResult{}
-		err = json.Unmarshal(data, result)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't unmarshal spotify search response")
-		}
-		return result, nil
+	c.client.log.Debugf("mix: %s", q.Encode())
+	result := &RecommendationResult{}
+	err := c.client.getJSON(ctx, "recommendations", q, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify mix")
 	}
-	return nil, nil
+	return result, nil
 }
@@ -0,0 +1,211 @@
+package spotify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/cache"
+)
+
+// CachePolicies maps endpoints to how long their responses are cached.
+// Keys are endpoint templates as reported to observers, such as
+// artists/{id}/albums, or a template followed by /* to cover that
+// endpoint and everything below it.  Exact keys win over /* keys, and
+// longer /* keys over shorter ones.  Endpoints with no policy are cached
+// for CacheTime, and a zero duration disables caching.
+type CachePolicies map[string]time.Duration
+
+// DefaultCachePolicies returns the policies used when none are given:
+// audio features and analyses never change, genre seeds rarely do, search
+// results go stale quickly and player state is never cached.
+func DefaultCachePolicies() CachePolicies {
+	return CachePolicies{
+		"audio-analysis/*": 365 * 24 * time.Hour,
+		"audio-features/*": 365 * 24 * time.Hour,
+		"recommendations/available-genre-seeds": 7 * 24 * time.Hour,
+		"search": 15 * time.Minute,
+		"me/player/*": 0,
+	}
+}
+
+// lookup returns the cache time for an endpoint template, if there's a
+// policy for it.
+func (p CachePolicies) lookup(endpoint string) (time.Duration, bool) {
+	if d, ok := p[endpoint]; ok {
+		return d, true
+	}
+	for ep := endpoint; ep != "." && ep != "/" && ep != ""; ep = path.Dir(ep) {
+		if d, ok := p[ep + "/*"]; ok {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+type CacheMode int
+
+const (
+	// CacheModeDefault serves fresh cached responses and caches new ones.
+	CacheModeDefault CacheMode = iota
+	// CacheModeRefresh ignores fresh cached responses, but still
+	// revalidates stored ones by ETag and caches the result.
+	CacheModeRefresh
+	// CacheModeSkip neither reads nor writes the cache.
+	CacheModeSkip
+)
+
+type cacheModeKey struct{}
+
+// WithCacheMode returns a context that makes the api calls it's passed to
+// use the cache according to mode, for example to force a refresh right
+// after changing something.
+func WithCacheMode(ctx context.Context, mode CacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+func cacheModeFrom(ctx context.Context) CacheMode {
+	mode, _ := ctx.Value(cacheModeKey{}).(CacheMode)
+	return mode
+}
+
+// responseCache caches api responses in a cache.CacheStore.  Once an
+// entry expires it's kept around, and if it has an ETag the next request
+// for it is sent with If-None-Match.  A 304 then renews the entry without
+// downloading the body again.
+type responseCache struct {
+	store cache.CacheStore
+	client *httpClient
+	maxResponseSize int64
+}
+
+func newResponseCache(store cache.CacheStore, client *httpClient, maxResponseSize int64) *responseCache {
+	return &responseCache{store: store, client: client, maxResponseSize: maxResponseSize}
+}
+
+// headers that a 304 may update on the stored response
+var revalidatedHeaders = []string{"Cache-Control", "Date", "Etag", "Expires", "Vary"}
+
+// cacheEntryName names entries the same way cache.Cache does, so that
+// existing cache directories stay valid.
+func cacheEntryName(req *http.Request) string {
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+	code := hex.EncodeToString(sum[:])
+	return path.Join(code[0:2], code[2:4], code[4:])
+}
+
+func (c *responseCache) Do(req *http.Request, cacheTime time.Duration) (*http.Response, error) {
+	mode := cacheModeFrom(req.Context())
+	if req.Method != http.MethodGet || cacheTime == 0 || mode == CacheModeSkip {
+		return c.client.Do(req)
+	}
+	name := cacheEntryName(req)
+	if mode != CacheModeRefresh {
+		res, err := c.load(name, req, cacheTime)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			return res, nil
+		}
+	}
+	// a negative cache time opens the entry regardless of its age
+	cf, err := c.store.Open(name, -1)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open cache entry")
+	}
+	defer cf.Close()
+	stale, body := readCacheEntry(cf, req)
+	if stale != nil && stale.Header.Get("ETag") != "" {
+		req.Header.Set("If-None-Match", stale.Header.Get("ETag"))
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified && stale != nil {
+		res.Body.Close()
+		for _, k := range revalidatedHeaders {
+			if v, ok := res.Header[k]; ok {
+				stale.Header[k] = v
+			}
+		}
+		requestStatsFrom(req.Context()).revalidate()
+		c.client.log.Debugf("%s %s: not modified", req.Method, req.URL)
+		return c.save(cf, stale, body), nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, c.maxResponseSize + 1))
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read spotify response")
+	}
+	if int64(len(data)) > c.maxResponseSize {
+		return nil, errors.Wrapf(ErrResponseTooLarge, "response from %s exceeds %d bytes", req.URL, c.maxResponseSize)
+	}
+	return c.save(cf, res, data), nil
+}
+
+// load returns the entry for req if it's younger than cacheTime.
+func (c *responseCache) load(name string, req *http.Request, cacheTime time.Duration) (*http.Response, error) {
+	cf, err := c.store.Open(name, cacheTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open cache entry")
+	}
+	defer cf.Close()
+	if !cf.Valid() {
+		return nil, nil
+	}
+	res, _ := readCacheEntry(cf, req)
+	return res, nil
+}
+
+// save writes res with the given body to cf, which also renews its
+// lifetime, and returns res ready to be read again.  Failing to write the
+// entry isn't fatal, since the response itself is fine.
+func (c *responseCache) save(cf cache.CacheFile, res *http.Response, body []byte) *http.Response {
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.TransferEncoding = nil
+	data, err := httputil.DumpResponse(res, true)
+	if err == nil {
+		_, err = cf.Write(data)
+	}
+	if err != nil {
+		c.client.log.Warnf("can't cache response for %s: %s", res.Request.URL, err)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return res
+}
+
+// readCacheEntry parses a stored response, returning nil if the entry is
+// empty or unreadable.
+func readCacheEntry(cf cache.CacheFile, req *http.Request) (*http.Response, []byte) {
+	data, err := ioutil.ReadAll(cf)
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, nil
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return res, body
+}
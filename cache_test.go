@@ -0,0 +1,78 @@
+package spotify_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+// statusRecorder records the status of every response that comes back
+// from the server.
+type statusRecorder struct {
+	mutex sync.Mutex
+	statuses []int
+}
+
+func (sr *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		sr.mutex.Lock()
+		sr.statuses = append(sr.statuses, res.StatusCode)
+		sr.mutex.Unlock()
+	}
+	return res, err
+}
+
+func TestRevalidateExpiredEntry(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tr := s.AddTrack(&spotify.Track{Name: "Cached"})
+	store := spotifytest.NewMemoryCacheStore()
+	rec := &statusRecorder{}
+	var infos []*spotify.RequestInfo
+	opts := s.ClientOptions()
+	opts.CacheStore = store
+	opts.CacheTime = time.Hour
+	opts.Transport = rec
+	opts.Observer = spotify.ObserverFunc(func(info *spotify.RequestInfo) {
+		infos = append(infos, info)
+	})
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Age(2 * time.Hour)
+	rec.statuses = nil
+	got, err := c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != tr.ID || got.Name != "Cached" {
+		t.Errorf("got track %s %q from the revalidated entry", got.ID, got.Name)
+	}
+	if len(rec.statuses) != 1 || rec.statuses[0] != http.StatusNotModified {
+		t.Errorf("server answered %v, want a single 304", rec.statuses)
+	}
+	info := infos[len(infos) - 1]
+	if !info.Revalidated || info.CacheHit {
+		t.Errorf("got revalidated %t and cache hit %t, want a revalidation", info.Revalidated, info.CacheHit)
+	}
+	// the 304 renewed the entry
+	rec.statuses = nil
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = infos[len(infos) - 1]
+	if len(rec.statuses) != 0 || !info.CacheHit {
+		t.Errorf("renewed entry wasn't served from the cache: statuses %v", rec.statuses)
+	}
+}
@@ -0,0 +1,170 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/apiclient"
+)
+
+// httpClient is a rate limited wrapper around an http.Client that sets
+// the user agent on outgoing requests.
+type httpClient struct {
+	client *http.Client
+	userAgent string
+	limiter *RateLimiter
+	log *logger
+}
+
+func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	err := c.limiter.Wait(req.Context())
+	requestStatsFrom(req.Context()).record(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	c.log.Debugf("%s %s", req.Method, req.URL)
+	return c.client.Do(req)
+}
+
+func (c *httpClient) Get(u string) (*http.Response, error) {
+	return c.GetContext(context.Background(), u)
+}
+
+func (c *httpClient) GetContext(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// apiClient resolves resources against the api base url, authenticates
+// requests and caches the responses.
+type apiClient struct {
+	baseURL *url.URL
+	cacheTime time.Duration
+	cachePolicies CachePolicies
+	auth apiclient.Authenticator
+	cache *responseCache
+	privateCache *responseCache
+	client *httpClient
+	maxRetries int
+	maxRetryWait time.Duration
+	maxResponseSize int64
+	observer Observer
+	log *logger
+}
+
+func (c *apiClient) Client() *httpClient {
+	return c.client
+}
+
+func (c *apiClient) Get(rsrc string, args url.Values) (*http.Response, error) {
+	return c.GetContext(context.Background(), rsrc, args)
+}
+
+func (c *apiClient) GetContext(ctx context.Context, rsrc string, args url.Values) (*http.Response, error) {
+	u, err := c.baseURL.Parse(rsrc)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse api request uri " + rsrc)
+	}
+	if args != nil {
+		u.RawQuery = args.Encode()
+	}
+	cacheTime := c.cacheTimeFor(rsrc)
+	cacher := c.cache
+	if isPrivateResource(rsrc) {
+		if c.privateCache != nil {
+			cacher = c.privateCache
+		} else {
+			// the shared cache is keyed by url alone, so whoever's token
+			// fetched me first would be served to everyone
+			cacheTime = 0
+		}
+	}
+	req, err := c.newRequest(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	res, err := cacher.Do(req, cacheTime)
+	if err != nil {
+		return res, errors.Wrap(err, "can't cache api response")
+	}
+	// a 401 means the token was revoked or expired early, so drop it and
+	// try once more with a fresh one
+	inv, ok := c.auth.(TokenInvalidator)
+	if !ok || res.StatusCode != http.StatusUnauthorized {
+		return res, nil
+	}
+	res.Body.Close()
+	c.log.Infof("%s: spotify token rejected; reauthenticating", rsrc)
+	inv.InvalidateToken(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+	req, err = c.newRequest(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	res, err = cacher.Do(req, cacheTime)
+	if err != nil {
+		return res, errors.Wrap(err, "can't cache api response")
+	}
+	return res, nil
+}
+
+func (c *apiClient) cacheTimeFor(rsrc string) time.Duration {
+	d, ok := c.cachePolicies.lookup(endpointTemplate(rsrc))
+	if ok {
+		return d
+	}
+	return c.cacheTime
+}
+
+func (c *apiClient) newRequest(ctx context.Context, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create api get request")
+	}
+	if c.auth != nil {
+		err = c.auth.AuthenticateRequest(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't auth api get request")
+		}
+	}
+	return req, nil
+}
+
+// TokenInvalidator is implemented by authenticators that cache a token.
+// InvalidateToken is called with a token the api has rejected, so that
+// the next request gets a new one.
+type TokenInvalidator interface {
+	InvalidateToken(token string)
+}
+
+// isPrivateResource reports whether rsrc is specific to the current user,
+// and so mustn't be served from a cache shared between users.
+func isPrivateResource(rsrc string) bool {
+	rsrc = strings.TrimPrefix(rsrc, "/")
+	rsrc = strings.TrimPrefix(rsrc, "v1/")
+	return rsrc == "me" || strings.HasPrefix(rsrc, "me/")
+}
+
+// sleepContext sleeps for d, returning early with the context's error if
+// ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package spotify_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func countRequests(s *spotifytest.Server, prefix string) int {
+	n := 0
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, prefix) {
+			n += 1
+		}
+	}
+	return n
+}
+
+func TestReauthenticateAfter401(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tr := s.AddTrack(&spotify.Track{Name: "Track"})
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ExpireTokens()
+	got, err := c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatalf("request after the token was revoked failed: %s", err)
+	}
+	if got.ID != tr.ID {
+		t.Errorf("got track %s, want %s", got.ID, tr.ID)
+	}
+	if n := countRequests(s, "POST /api/token"); n != 2 {
+		t.Errorf("made %d token requests, want 2", n)
+	}
+	if n := countRequests(s, "GET /v1/tracks/"); n != 3 {
+		t.Errorf("made %d track requests, want 3", n)
+	}
+}
+
+func TestUnauthorizedAfterReauthenticating(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tr := s.AddTrack(&spotify.Track{Name: "Track"})
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Fail(spotifytest.Failure{Path: "/v1/tracks", Status: 401})
+	_, err = c.GetTrack(tr.ID)
+	if !errors.Is(err, spotify.ErrUnauthorized) {
+		t.Fatalf("got error %v, want ErrUnauthorized", err)
+	}
+	// one token at construction, and one more for the single replay
+	if n := countRequests(s, "POST /api/token"); n != 2 {
+		t.Errorf("made %d token requests, want 2", n)
+	}
+	if n := countRequests(s, "GET /v1/tracks/"); n != 2 {
+		t.Errorf("made %d track requests, want 2", n)
+	}
+}
@@ -0,0 +1,95 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotFound = errors.New("spotify resource not found")
+	ErrUnauthorized = errors.New("spotify request unauthorized")
+	ErrForbidden = errors.New("spotify request forbidden")
+	ErrRateLimited = errors.New("spotify rate limit exceeded")
+	ErrPremiumRequired = errors.New("spotify premium required")
+	ErrNoActiveDevice = errors.New("no active spotify device")
+)
+
+// APIError is returned for any unsuccessful response from the api or the
+// accounts service.  Use errors.Is with the Err* sentinels to check the
+// cause.
+type APIError struct {
+	Status int `json:"status"`
+	Message string `json:"message"`
+	Reason string `json:"reason,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("spotify %s: %d %s", e.Endpoint, e.Status, http.StatusText(e.Status))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Reason != "" {
+		msg += " (" + e.Reason + ")"
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.Status == http.StatusForbidden
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	case ErrPremiumRequired:
+		return e.Reason == "PREMIUM_REQUIRED"
+	case ErrNoActiveDevice:
+		return e.Reason == "NO_ACTIVE_DEVICE"
+	}
+	return false
+}
+
+type apiErrorBody struct {
+	Error json.RawMessage `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// newAPIError builds an APIError from an unsuccessful response, parsing
+// either the api's {"error":{...}} body or the accounts service's
+// {"error":"...","error_description":"..."} body.  It consumes and
+// closes the response body.
+func newAPIError(res *http.Response, endpoint string) *APIError {
+	defer res.Body.Close()
+	e := &APIError{
+		Status: res.StatusCode,
+		Endpoint: endpoint,
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 64 * 1024))
+	if err != nil || len(data) == 0 {
+		return e
+	}
+	body := &apiErrorBody{}
+	err = json.Unmarshal(data, body)
+	if err != nil || len(body.Error) == 0 {
+		return e
+	}
+	var code string
+	if json.Unmarshal(body.Error, &code) == nil {
+		e.Reason = code
+		e.Message = body.ErrorDescription
+		return e
+	}
+	json.Unmarshal(body.Error, e)
+	e.Status = res.StatusCode
+	e.Endpoint = endpoint
+	return e
+}
@@ -0,0 +1,151 @@
+package spotify
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const authStateCookie = "spotify_auth_state"
+
+// LoginHandler serves /login, which redirects the user to spotify's
+// authorize page, and /callback, which spotify redirects back to.  Mount
+// it under a prefix with http.StripPrefix; RedirectURI must point at the
+// resulting callback url.
+type LoginHandler struct {
+	ClientID string
+	ClientSecret string
+	RedirectURI string
+	AccountsURL string
+	Scopes []string
+	ShowDialog bool
+	// TokenStore, if set, returns the store the new token is saved in.
+	TokenStore func(r *http.Request) (TokenStore, error)
+	// OnSuccess is called after a successful login.  If nil, the user is
+	// redirected to /.
+	OnSuccess func(w http.ResponseWriter, r *http.Request, auth *UserAuth)
+	// OnError is called if the login fails.  If nil, an error response is
+	// sent: 400 for a bad callback request, 502 if spotify won't exchange
+	// the code, and 500 for anything else.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+	HTTPClient *http.Client
+	Logger Logger
+}
+
+func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "login":
+		h.Login(w, r)
+	case "callback":
+		h.Callback(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *LoginHandler) newAuth() *UserAuth {
+	auth := NewUserAuth(h.ClientID, h.ClientSecret, h.RedirectURI)
+	if h.AccountsURL != "" {
+		auth.SetAccountsURL(h.AccountsURL)
+	}
+	if h.HTTPClient != nil {
+		auth.SetHTTPClient(h.HTTPClient)
+	}
+	if h.Logger != nil {
+		auth.SetLogger(h.Logger, false)
+	}
+	return auth
+}
+
+func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		h.fail(w, r, http.StatusInternalServerError, errors.Wrap(err, "can't generate spotify auth state"))
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name: authStateCookie,
+		Value: state,
+		Path: "/",
+		MaxAge: 600,
+		HttpOnly: true,
+		Secure: r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	auth := h.newAuth()
+	var u string
+	if h.ShowDialog {
+		u = auth.AuthURLWithDialog(state, h.Scopes...)
+	} else {
+		u = auth.AuthURL(state, h.Scopes...)
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+func (h *LoginHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(authStateCookie)
+	if err != nil || cookie.Value == "" {
+		h.fail(w, r, http.StatusBadRequest, errors.New("spotify auth state cookie missing"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: authStateCookie,
+		Value: "",
+		Path: "/",
+		MaxAge: -1,
+		HttpOnly: true,
+		Secure: r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(cookie.Value)) != 1 {
+		h.fail(w, r, http.StatusBadRequest, errors.New("spotify authorization state mismatch"))
+		return
+	}
+	if msg := q.Get("error"); msg != "" {
+		h.fail(w, r, http.StatusBadRequest, errors.Errorf("spotify authorization failed: %s", msg))
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		h.fail(w, r, http.StatusBadRequest, errors.New("spotify authorization code missing"))
+		return
+	}
+	auth := h.newAuth()
+	if h.TokenStore != nil {
+		store, err := h.TokenStore(r)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, errors.Wrap(err, "can't get spotify token store"))
+			return
+		}
+		err = auth.UseTokenStore(store)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	_, err = auth.Exchange(code)
+	if err != nil {
+		h.fail(w, r, http.StatusBadGateway, err)
+		return
+	}
+	if h.OnSuccess != nil {
+		h.OnSuccess(w, r, auth)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (h *LoginHandler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.OnError != nil {
+		h.OnError(w, r, err)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,198 @@
+package spotify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+const handlerRedirectURI = "http://app.example.com/auth/callback"
+
+type handlerResult struct {
+	auth *spotify.UserAuth
+	err error
+}
+
+func loginHandler(s *spotifytest.Server, store spotify.TokenStore) (*spotify.LoginHandler, *handlerResult) {
+	result := &handlerResult{}
+	h := &spotify.LoginHandler{
+		ClientID: spotifytest.ClientID,
+		ClientSecret: spotifytest.ClientSecret,
+		RedirectURI: handlerRedirectURI,
+		AccountsURL: s.AccountsURL(),
+		Scopes: []string{spotify.ScopeUserReadPrivate, spotify.ScopeUserReadEmail},
+		TokenStore: func(r *http.Request) (spotify.TokenStore, error) {
+			return store, nil
+		},
+		OnSuccess: func(w http.ResponseWriter, r *http.Request, auth *spotify.UserAuth) {
+			result.auth = auth
+		},
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			result.err = err
+		},
+		Logger: spotify.NopLogger,
+	}
+	return h, result
+}
+
+// login serves /login and returns the state cookie it set and the url it
+// redirected to.
+func login(t *testing.T, h *spotify.LoginHandler) (*http.Cookie, *url.URL) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/auth/login", nil))
+	res := w.Result()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("login returned %s, want a redirect", res.Status)
+	}
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == "spotify_auth_state" {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value == "" || !cookie.HttpOnly {
+		t.Fatalf("login set cookies %v, want an http only state cookie", res.Cookies())
+	}
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie, u
+}
+
+// authorize visits the authorize url and returns the callback url the
+// accounts service redirects back to.
+func authorize(t *testing.T, authURL *url.URL) *url.URL {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func callback(h *spotify.LoginHandler, callbackURL *url.URL, cookie *http.Cookie) {
+	req := httptest.NewRequest("GET", "/auth/callback?" + callbackURL.RawQuery, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestLoginHandlerLogin(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	h, _ := loginHandler(s, spotify.NewMemoryTokenStore())
+	cookie, u := login(t, h)
+	if !strings.HasPrefix(u.String(), s.AccountsURL() + "authorize?") {
+		t.Errorf("login redirected to %s, want the authorize page", u)
+	}
+	q := u.Query()
+	if q.Get("state") != cookie.Value {
+		t.Errorf("got state %q, want the cookie's %q", q.Get("state"), cookie.Value)
+	}
+	if q.Get("scope") != spotify.ScopeUserReadPrivate + " " + spotify.ScopeUserReadEmail {
+		t.Errorf("got scope %q", q.Get("scope"))
+	}
+	if q.Get("redirect_uri") != handlerRedirectURI || q.Get("client_id") != spotifytest.ClientID {
+		t.Errorf("got redirect uri %q and client id %q", q.Get("redirect_uri"), q.Get("client_id"))
+	}
+}
+
+func TestLoginHandlerCallback(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	store := spotify.NewMemoryTokenStore()
+	h, result := loginHandler(s, store)
+	cookie, u := login(t, h)
+	callback(h, authorize(t, u), cookie)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.auth == nil {
+		t.Fatal("OnSuccess wasn't called")
+	}
+	tok, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok == nil || tok.AccessToken != result.auth.Token().AccessToken || tok.RefreshToken == "" {
+		t.Errorf("store has %+v, want the new token", tok)
+	}
+	if result.auth.Token().Scope != spotify.ScopeUserReadPrivate + " " + spotify.ScopeUserReadEmail {
+		t.Errorf("got scope %q", result.auth.Token().Scope)
+	}
+}
+
+func TestLoginHandlerCallbackFailures(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tests := []struct{
+		name string
+		want string
+		tamper func(cookie *http.Cookie, u *url.URL) *http.Cookie
+	}{
+		{
+			name: "missing cookie",
+			want: "cookie missing",
+			tamper: func(cookie *http.Cookie, u *url.URL) *http.Cookie {
+				return nil
+			},
+		},
+		{
+			name: "state mismatch",
+			want: "state mismatch",
+			tamper: func(cookie *http.Cookie, u *url.URL) *http.Cookie {
+				q := u.Query()
+				q.Set("state", "forged")
+				u.RawQuery = q.Encode()
+				return cookie
+			},
+		},
+		{
+			name: "access denied",
+			want: "access_denied",
+			tamper: func(cookie *http.Cookie, u *url.URL) *http.Cookie {
+				q := url.Values{}
+				q.Set("error", "access_denied")
+				q.Set("state", u.Query().Get("state"))
+				u.RawQuery = q.Encode()
+				return cookie
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := spotify.NewMemoryTokenStore()
+			h, result := loginHandler(s, store)
+			cookie, u := login(t, h)
+			u = authorize(t, u)
+			cookie = test.tamper(cookie, u)
+			callback(h, u, cookie)
+			if result.auth != nil {
+				t.Error("OnSuccess was called")
+			}
+			if result.err == nil || !strings.Contains(result.err.Error(), test.want) {
+				t.Errorf("got error %v, want %s", result.err, test.want)
+			}
+			tok, _ := store.Load()
+			if tok != nil {
+				t.Errorf("store has %+v, want nothing", tok)
+			}
+		})
+	}
+}
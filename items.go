@@ -1,13 +1,10 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"net/url"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -60,38 +57,39 @@ func (tis *TypedItems) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// nextPage turns the next link of a page into a resource and query for
+// getJSON.  Spotify's links are absolute, so the path is taken relative
+// to its /v1/ prefix, and resolved against the base url from there on;
+// that keeps any prefix a proxying base url adds.
+func nextPage(href string) (string, url.Values, error) {
+	nu, err := url.Parse(href)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "can't parse next page url " + href)
+	}
+	rsrc := nu.Path
+	if i := strings.Index(rsrc, "/v1/"); i >= 0 {
+		rsrc = rsrc[i + len("/v1/"):]
+	} else {
+		rsrc = strings.TrimPrefix(rsrc, "/")
+	}
+	return rsrc, nu.Query(), nil
+}
+
 func (c *SpotifyClient) GetPaged(rsrc string, q url.Values) (*SearchResult, error) {
+	return c.GetPagedContext(context.Background(), rsrc, q)
+}
+
+func (c *SpotifyClient) GetPagedContext(ctx context.Context, rsrc string, q url.Values) (*SearchResult, error) {
 	result := &SearchResult{
 		Artists: []*Artist{},
 		Albums: []*Album{},
 		Tracks: []*Track{},
 	}
 	for {
-		res, err := c.client.Get(rsrc, q)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't execute spotify paged request")
-		}
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			if res.StatusCode == http.StatusTooManyRequests {
-				wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
-				if err == nil {
-					log.Printf("API ratelimit; waiting %d seconds", wait)
-					time.Sleep(time.Duration(wait + 1) * time.Second)
-					continue
-				}
-			}
-			return nil, errors.New(res.Status)
-		}
-		data, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, errors.Wrap(err, "can't read spotify search response")
-		}
 		page := &PagingObject{}
-		err = json.Unmarshal(data, page)
+		err := c.client.getJSON(ctx, rsrc, q, page)
 		if err != nil {
-			return nil, errors.Wrap(err, "can't unmarshal spotify search response")
+			return nil, errors.Wrap(err, "can't get spotify paged response")
 		}
 		for _, item := range page.Items {
 			switch it := item.(type) {
@@ -106,12 +104,10 @@ func (c *SpotifyClient) GetPaged(rsrc string, q url.Values) (*SearchResult, erro
 		if page.NextHref == nil || *page.NextHref == "" {
 			break
 		}
-		nu, err := url.Parse(*page.NextHref)
+		rsrc, q, err = nextPage(*page.NextHref)
 		if err != nil {
-			break
+			return nil, err
 		}
-		rsrc = nu.Path
-		q = nu.Query()
 	}
 	c.addClientToArtists(result.Artists...)
 	c.addClientToAlbums(result.Albums...)
@@ -0,0 +1,64 @@
+package spotify_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+// addLongAlbum adds an album with n tracks split over two discs.
+func addLongAlbum(s *spotifytest.Server, n int) *spotify.Album {
+	alb := &spotify.Album{Name: "Long Album", Artists: []*spotify.Artist{{Name: "Artist"}}}
+	for i := 0; i < n; i += 1 {
+		disc := 1
+		num := i + 1
+		if i >= n / 2 {
+			disc = 2
+			num = i - n / 2 + 1
+		}
+		alb.Tracks = append(alb.Tracks, &spotify.Track{
+			Name: fmt.Sprintf("Track %d.%d", disc, num),
+			DiscNumber: disc,
+			TrackNumber: num,
+		})
+	}
+	return s.AddAlbum(alb)
+}
+
+func TestPagingThroughProxy(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	alb := addLongAlbum(s, 120)
+	// the proxy only answers under its prefix, so a next link resolved
+	// without it gets a 404
+	proxy := httptest.NewServer(http.StripPrefix("/spotify", s))
+	defer proxy.Close()
+	opts := s.ClientOptions()
+	opts.BaseURL = proxy.URL + "/spotify/v1/"
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, err := c.GetPaged("albums/" + alb.ID + "/tracks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Tracks) != 120 {
+		t.Errorf("GetPaged got %d tracks, want 120", len(sr.Tracks))
+	}
+	full, err := c.GetAlbum(alb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks, err := full.GetTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 120 {
+		t.Errorf("GetTracks got %d tracks, want 120", len(tracks))
+	}
+}
@@ -0,0 +1,133 @@
+package spotify
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+)
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+	LogNone
+)
+
+func (lvl LogLevel) String() string {
+	switch lvl {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return "NONE"
+}
+
+// Logger receives the library's log messages.  Messages have already had
+// tokens, codes and secrets redacted unless ClientOptions.LogSecrets is
+// set.
+type Logger interface {
+	Log(level LogLevel, msg string)
+}
+
+// StdLogger writes messages at or above Level to a standard library
+// logger, or to the log package's default logger if Logger is nil.
+type StdLogger struct {
+	Logger *log.Logger
+	Level LogLevel
+}
+
+func NewStdLogger(logger *log.Logger, level LogLevel) *StdLogger {
+	return &StdLogger{Logger: logger, Level: level}
+}
+
+func (l *StdLogger) Log(level LogLevel, msg string) {
+	if level < l.Level {
+		return
+	}
+	msg = level.String() + " " + msg
+	if l.Logger == nil {
+		log.Output(4, msg)
+	} else {
+		l.Logger.Output(4, msg)
+	}
+}
+
+type nopLogger struct{}
+
+func (l nopLogger) Log(level LogLevel, msg string) {}
+
+var NopLogger Logger = nopLogger{}
+
+var DefaultLogger Logger = NewStdLogger(nil, LogInfo)
+
+var redactors = []struct{
+	re *regexp.Regexp
+	repl string
+}{
+	{
+		regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`),
+		"$1 [REDACTED]",
+	},
+	{
+		regexp.MustCompile(`(?i)(^|[?&\s])(access_token|refresh_token|client_secret|code|code_verifier)=[^&\s"]+`),
+		"$1$2=[REDACTED]",
+	},
+	{
+		regexp.MustCompile(`(?i)"(access_token|refresh_token|client_secret|code|code_verifier)"\s*:\s*"[^"]*"`),
+		`"$1":"[REDACTED]"`,
+	},
+}
+
+// Redact masks bearer and basic credentials, and token, code and secret
+// values in query strings, forms and json.
+func Redact(s string) string {
+	for _, r := range redactors {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+// logger formats messages for a Logger, redacting secrets on the way.
+type logger struct {
+	out Logger
+	unredacted bool
+}
+
+func newLogger(out Logger, logSecrets bool) *logger {
+	if out == nil {
+		out = DefaultLogger
+	}
+	return &logger{out: out, unredacted: logSecrets}
+}
+
+func (l *logger) logf(level LogLevel, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !l.unredacted {
+		msg = Redact(msg)
+	}
+	l.out.Log(level, msg)
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.logf(LogDebug, format, args...)
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.logf(LogInfo, format, args...)
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.logf(LogWarn, format, args...)
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.logf(LogError, format, args...)
+}
@@ -0,0 +1,238 @@
+package spotify_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rclancey/spotify"
+)
+
+const artistPayload = `{
+	"external_urls": {"spotify": "https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF"},
+	"followers": {"href": null, "total": 306565},
+	"genres": ["indie folk", "indie pop"],
+	"href": "https://api.spotify.com/v1/artists/0OdUWJ0sBjDrqHygGUXeCF",
+	"id": "0OdUWJ0sBjDrqHygGUXeCF",
+	"images": [
+		{"height": 816, "url": "https://i.scdn.co/image/eb266625dab075341e8c4378a177a27370f91903", "width": 1000},
+		{"height": 163, "url": "https://i.scdn.co/image/4ba9ec2ac5d1f4ec5bd1d4ad4d0df1c33bd2e3fc", "width": 200}
+	],
+	"name": "Band of Horses",
+	"popularity": 59,
+	"type": "artist",
+	"uri": "spotify:artist:0OdUWJ0sBjDrqHygGUXeCF"
+}`
+
+const simpleArtistPayload = `{
+	"external_urls": {"spotify": "https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF"},
+	"href": "https://api.spotify.com/v1/artists/0OdUWJ0sBjDrqHygGUXeCF",
+	"id": "0OdUWJ0sBjDrqHygGUXeCF",
+	"name": "Band of Horses",
+	"type": "artist",
+	"uri": "spotify:artist:0OdUWJ0sBjDrqHygGUXeCF"
+}`
+
+const simpleAlbumPayload = `{
+	"album_group": "appears_on",
+	"album_type": "compilation",
+	"artists": [` + simpleArtistPayload + `],
+	"available_markets": ["CA", "US"],
+	"external_urls": {"spotify": "https://open.spotify.com/album/6UXCm6bOO4gFlDQZV5yL37"},
+	"href": "https://api.spotify.com/v1/albums/6UXCm6bOO4gFlDQZV5yL37",
+	"id": "6UXCm6bOO4gFlDQZV5yL37",
+	"images": [
+		{"height": 640, "url": "https://i.scdn.co/image/ab67616d0000b273a7ea08ab3914c5fb2084a8ac", "width": 640}
+	],
+	"name": "Twilight (Original Motion Picture Soundtrack)",
+	"release_date": "2008-11-04",
+	"release_date_precision": "day",
+	"total_tracks": 15,
+	"type": "album",
+	"uri": "spotify:album:6UXCm6bOO4gFlDQZV5yL37"
+}`
+
+const trackPayload = `{
+	"album": ` + simpleAlbumPayload + `,
+	"artists": [` + simpleArtistPayload + `],
+	"disc_number": 1,
+	"duration_ms": 213066,
+	"explicit": false,
+	"external_ids": {"isrc": "USSM10802911"},
+	"external_urls": {"spotify": "https://open.spotify.com/track/3bWnq2JwmGrSgAHxwIIG8Q"},
+	"href": "https://api.spotify.com/v1/tracks/3bWnq2JwmGrSgAHxwIIG8Q",
+	"id": "3bWnq2JwmGrSgAHxwIIG8Q",
+	"is_local": false,
+	"is_playable": true,
+	"linked_from": {
+		"external_urls": {"spotify": "https://open.spotify.com/track/1dSdSgYBCPgixgMWVO7wNM"},
+		"href": "https://api.spotify.com/v1/tracks/1dSdSgYBCPgixgMWVO7wNM",
+		"id": "1dSdSgYBCPgixgMWVO7wNM",
+		"type": "track",
+		"uri": "spotify:track:1dSdSgYBCPgixgMWVO7wNM"
+	},
+	"name": "The Funeral",
+	"popularity": 64,
+	"preview_url": null,
+	"restrictions": {"reason": "market"},
+	"track_number": 5,
+	"type": "track",
+	"uri": "spotify:track:3bWnq2JwmGrSgAHxwIIG8Q"
+}`
+
+const albumTrackPayload = `{
+	"artists": [` + simpleArtistPayload + `],
+	"disc_number": 1,
+	"duration_ms": 258626,
+	"explicit": false,
+	"external_urls": {"spotify": "https://open.spotify.com/track/5Ucxs2Xi2PfHxqUHKAxSsS"},
+	"href": "https://api.spotify.com/v1/tracks/5Ucxs2Xi2PfHxqUHKAxSsS",
+	"id": "5Ucxs2Xi2PfHxqUHKAxSsS",
+	"is_local": false,
+	"is_playable": true,
+	"name": "Is There a Ghost",
+	"preview_url": "https://p.scdn.co/mp3-preview/4f1d1f7b0bc2d9b0c1e4a2bb3d6d1b4a6e3b8a1e",
+	"track_number": 1,
+	"type": "track",
+	"uri": "spotify:track:5Ucxs2Xi2PfHxqUHKAxSsS"
+}`
+
+const albumPayload = `{
+	"album_type": "album",
+	"artists": [` + simpleArtistPayload + `],
+	"copyrights": [
+		{"text": "2010 Columbia Records", "type": "C"},
+		{"text": "2010 Columbia Records", "type": "P"}
+	],
+	"external_ids": {"upc": "886976923920"},
+	"external_urls": {"spotify": "https://open.spotify.com/album/3VZ2SGeSzqcdcMpVXFNsXT"},
+	"genres": [],
+	"href": "https://api.spotify.com/v1/albums/3VZ2SGeSzqcdcMpVXFNsXT?market=US",
+	"id": "3VZ2SGeSzqcdcMpVXFNsXT",
+	"images": [
+		{"height": 640, "url": "https://i.scdn.co/image/ab67616d0000b2730d3e46fa5aeaa80ca7dd85b8", "width": 640}
+	],
+	"label": "Columbia",
+	"name": "Infinite Arms",
+	"popularity": 52,
+	"release_date": "2010-05-14",
+	"release_date_precision": "day",
+	"restrictions": {"reason": "explicit"},
+	"total_tracks": 51,
+	"tracks": {
+		"href": "https://api.spotify.com/v1/albums/3VZ2SGeSzqcdcMpVXFNsXT/tracks?offset=0&limit=1&market=US",
+		"items": [` + albumTrackPayload + `],
+		"limit": 1,
+		"next": "https://api.spotify.com/v1/albums/3VZ2SGeSzqcdcMpVXFNsXT/tracks?offset=1&limit=1&market=US",
+		"offset": 0,
+		"previous": null,
+		"total": 51
+	},
+	"type": "album",
+	"uri": "spotify:album:3VZ2SGeSzqcdcMpVXFNsXT"
+}`
+
+// roundTrip decodes payload into obj, encodes it again and checks that
+// everything in the payload survived.
+func roundTrip(t *testing.T, payload string, obj interface{}) {
+	err := json.Unmarshal([]byte(payload), obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got interface{}
+	err = json.Unmarshal([]byte(payload), &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareJSON(t, "$", want, got)
+}
+
+// compareJSON reports anything in want that's missing from or different
+// in got.  A null in want matches a missing or zero value, since omitempty
+// fields leave those out.
+func compareJSON(t *testing.T, path string, want, got interface{}) {
+	switch w := want.(type) {
+	case nil:
+		if got != nil && !reflect.ValueOf(got).IsZero() {
+			t.Errorf("%s: got %v, want null", path, got)
+		}
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: got %v, want an object", path, got)
+			return
+		}
+		for k, v := range w {
+			compareJSON(t, path + "." + k, v, g[k])
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			t.Errorf("%s: got %v, want %d items", path, got, len(w))
+			return
+		}
+		for i := range w {
+			compareJSON(t, fmt.Sprintf("%s[%d]", path, i), w[i], g[i])
+		}
+	default:
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTrackRoundTrip(t *testing.T) {
+	tr := &spotify.Track{}
+	roundTrip(t, trackPayload, tr)
+	if tr.ExternalIDs == nil || tr.ExternalIDs.ISRC != "USSM10802911" {
+		t.Errorf("got external ids %+v", tr.ExternalIDs)
+	}
+	if tr.LinkedFrom == nil || tr.LinkedFrom.ID != "1dSdSgYBCPgixgMWVO7wNM" {
+		t.Errorf("got linked from %+v", tr.LinkedFrom)
+	}
+	if tr.IsPlayable == nil || !*tr.IsPlayable {
+		t.Errorf("got is playable %v", tr.IsPlayable)
+	}
+}
+
+func TestAlbumRoundTrip(t *testing.T) {
+	alb := &spotify.Album{}
+	roundTrip(t, albumPayload, alb)
+	if len(alb.Tracks) != 1 || alb.Tracks[0].ID != "5Ucxs2Xi2PfHxqUHKAxSsS" {
+		t.Errorf("got tracks %v, want the first page's", alb.Tracks)
+	}
+	if len(alb.Copyrights) != 2 || alb.TotalTracks != 51 {
+		t.Errorf("got copyrights %v and %d total tracks", alb.Copyrights, alb.TotalTracks)
+	}
+	// a second round trip must keep the page too
+	data, err := json.Marshal(alb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, string(data), &spotify.Album{})
+}
+
+func TestSimpleAlbumRoundTrip(t *testing.T) {
+	alb := &spotify.Album{}
+	roundTrip(t, simpleAlbumPayload, alb)
+	if alb.AlbumGroup != "appears_on" || alb.TotalTracks != 15 {
+		t.Errorf("got album group %q and %d total tracks", alb.AlbumGroup, alb.TotalTracks)
+	}
+}
+
+func TestArtistRoundTrip(t *testing.T) {
+	art := &spotify.Artist{}
+	roundTrip(t, artistPayload, art)
+	if art.Followers == nil || art.Followers.Total != 306565 || len(art.Images) != 2 {
+		t.Errorf("got followers %+v and %d images", art.Followers, len(art.Images))
+	}
+}
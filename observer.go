@@ -0,0 +1,226 @@
+package spotify
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestInfo describes one api call, including any retries.
+type RequestInfo struct {
+	// Endpoint is the resource with ids replaced by {id}, e.g.
+	// artists/{id}/albums.
+	Endpoint string
+	Method string
+	// Status is the final response status, or 0 if no response was
+	// received.
+	Status int
+	Latency time.Duration
+	Retries int
+	CacheHit bool
+	// Revalidated is set when an expired cache entry was renewed by a
+	// 304 instead of being downloaded again.
+	Revalidated bool
+	// RateLimitWait is the total time spent waiting on the rate limiter.
+	RateLimitWait time.Duration
+	Err error
+}
+
+// Observer is called once for every api call, after it completes.
+type Observer interface {
+	ObserveRequest(info *RequestInfo)
+}
+
+type ObserverFunc func(info *RequestInfo)
+
+func (f ObserverFunc) ObserveRequest(info *RequestInfo) {
+	f(info)
+}
+
+// requestStats is carried in a request's context so that the http client
+// can record what happened below the cache.
+type requestStats struct {
+	mutex sync.Mutex
+	sent int
+	rateLimitWait time.Duration
+	revalidated bool
+}
+
+type requestStatsKey struct{}
+
+func withRequestStats(ctx context.Context) (context.Context, *requestStats) {
+	stats := &requestStats{}
+	return context.WithValue(ctx, requestStatsKey{}, stats), stats
+}
+
+func requestStatsFrom(ctx context.Context) *requestStats {
+	stats, _ := ctx.Value(requestStatsKey{}).(*requestStats)
+	return stats
+}
+
+func (s *requestStats) record(wait time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.sent += 1
+	s.rateLimitWait += wait
+	s.mutex.Unlock()
+}
+
+func (s *requestStats) revalidate() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.revalidated = true
+	s.mutex.Unlock()
+}
+
+var idCollections = map[string]bool{
+	"albums": true,
+	"artists": true,
+	"audio-analysis": true,
+	"audio-features": true,
+	"categories": true,
+	"episodes": true,
+	"playlists": true,
+	"shows": true,
+	"tracks": true,
+	"users": true,
+}
+
+// endpointTemplate turns a resource path into a template by replacing the
+// ids that follow collection names with {id}.
+func endpointTemplate(rsrc string) string {
+	if strings.Contains(rsrc, "://") {
+		return "image"
+	}
+	rsrc = strings.TrimPrefix(rsrc, "/")
+	rsrc = strings.TrimPrefix(rsrc, "v1/")
+	parts := strings.Split(rsrc, "/")
+	for i := 1; i < len(parts); i += 1 {
+		if idCollections[parts[i - 1]] && parts[i] != "" {
+			parts[i] = "{id}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+const metricsSamples = 1024
+
+// RequestMetrics is an Observer that aggregates requests per endpoint.
+type RequestMetrics struct {
+	mutex sync.Mutex
+	endpoints map[string]*endpointMetrics
+}
+
+type endpointMetrics struct {
+	stats EndpointStats
+	latencies []time.Duration
+	next int
+}
+
+type EndpointStats struct {
+	Endpoint string `json:"endpoint"`
+	Method string `json:"method"`
+	Count int `json:"count"`
+	Errors int `json:"errors"`
+	CacheHits int `json:"cache_hits"`
+	Revalidations int `json:"revalidations"`
+	Retries int `json:"retries"`
+	RateLimitWait time.Duration `json:"rate_limit_wait"`
+	Statuses map[int]int `json:"statuses"`
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{endpoints: map[string]*endpointMetrics{}}
+}
+
+func (m *RequestMetrics) ObserveRequest(info *RequestInfo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := info.Method + " " + info.Endpoint
+	em, ok := m.endpoints[key]
+	if !ok {
+		em = &endpointMetrics{
+			stats: EndpointStats{
+				Endpoint: info.Endpoint,
+				Method: info.Method,
+				Statuses: map[int]int{},
+			},
+		}
+		m.endpoints[key] = em
+	}
+	em.stats.Count += 1
+	if info.Err != nil {
+		em.stats.Errors += 1
+	}
+	if info.CacheHit {
+		em.stats.CacheHits += 1
+	}
+	if info.Revalidated {
+		em.stats.Revalidations += 1
+	}
+	em.stats.Retries += info.Retries
+	em.stats.RateLimitWait += info.RateLimitWait
+	em.stats.Statuses[info.Status] += 1
+	if info.Latency > em.stats.Max {
+		em.stats.Max = info.Latency
+	}
+	// keep the most recent samples for the percentiles
+	if len(em.latencies) < metricsSamples {
+		em.latencies = append(em.latencies, info.Latency)
+	} else {
+		em.latencies[em.next] = info.Latency
+		em.next = (em.next + 1) % metricsSamples
+	}
+}
+
+// Report returns the stats for each endpoint, sorted by endpoint.
+func (m *RequestMetrics) Report() []*EndpointStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	report := make([]*EndpointStats, 0, len(m.endpoints))
+	for _, em := range m.endpoints {
+		st := em.stats
+		st.Statuses = map[int]int{}
+		for k, v := range em.stats.Statuses {
+			st.Statuses[k] = v
+		}
+		lat := make([]time.Duration, len(em.latencies))
+		copy(lat, em.latencies)
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		st.P50 = percentile(lat, 0.5)
+		st.P90 = percentile(lat, 0.9)
+		st.P99 = percentile(lat, 0.99)
+		report = append(report, &st)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Endpoint != report[j].Endpoint {
+			return report[i].Endpoint < report[j].Endpoint
+		}
+		return report[i].Method < report[j].Method
+	})
+	return report
+}
+
+func (m *RequestMetrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.endpoints = map[string]*endpointMetrics{}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted) - 1) + 0.5)
+	return sorted[i]
+}
@@ -0,0 +1,180 @@
+package spotify
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewPKCEAuth creates a UserAuth for a public client, such as a command
+// line or desktop tool, that can't keep a client secret.  Use AuthURLPKCE
+// and ExchangePKCE instead of AuthURL and Exchange, or just call LoginPKCE.
+func NewPKCEAuth(clientId, redirectURI string) *UserAuth {
+	return NewUserAuth(clientId, "", redirectURI)
+}
+
+func NewPKCEVerifier() (string, error) {
+	buf := make([]byte, 64)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", errors.Wrap(err, "can't generate pkce verifier")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (a *UserAuth) AuthURLPKCE(state, challenge string, scopes ...string) string {
+	q := url.Values{}
+	q.Set("code_challenge_method", "S256")
+	q.Set("code_challenge", challenge)
+	return a.authURL(state, false, scopes, q)
+}
+
+func (a *UserAuth) ExchangePKCE(code, verifier string) (*Token, error) {
+	q := url.Values{}
+	q.Set("grant_type", "authorization_code")
+	q.Set("code", code)
+	q.Set("redirect_uri", a.redirectURI)
+	q.Set("code_verifier", verifier)
+	return a.fetchToken(q, nil)
+}
+
+type PKCELogin struct {
+	ClientID string
+	// RedirectURI must be a loopback address registered with the app,
+	// e.g. http://127.0.0.1:8888/callback.  A port of 0 picks a free
+	// port, which is mostly useful against a fake accounts server.
+	RedirectURI string
+	Scopes []string
+	AccountsURL string
+	// Open is called with the authorize url; typically it launches a
+	// browser.  If nil, the url is logged for the user to visit.
+	Open func(authURL string) error
+	Timeout time.Duration
+	// Store, if set, receives the token after login and every refresh.
+	Store TokenStore
+	Logger Logger
+}
+
+type pkceResult struct {
+	code string
+	err error
+}
+
+// LoginPKCE runs the whole authorization code + PKCE flow: it listens on
+// the loopback redirect URI, sends the user to the authorize page, waits
+// for the redirect and exchanges the code for a token.
+func LoginPKCE(login PKCELogin) (*UserAuth, error) {
+	ru, err := url.Parse(login.RedirectURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse redirect uri " + login.RedirectURI)
+	}
+	host := ru.Hostname()
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, errors.Errorf("redirect uri %s is not a loopback address", login.RedirectURI)
+	}
+	listener, err := net.Listen("tcp", ru.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't listen for spotify redirect")
+	}
+	defer listener.Close()
+	if ru.Port() == "0" {
+		ru.Host = net.JoinHostPort(host, fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port))
+	}
+	if ru.Path == "" {
+		ru.Path = "/"
+	}
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+	state, err := NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+	auth := NewPKCEAuth(login.ClientID, ru.String())
+	if login.AccountsURL != "" {
+		auth.SetAccountsURL(login.AccountsURL)
+	}
+	if login.Logger != nil {
+		auth.SetLogger(login.Logger, false)
+	}
+	if login.Store != nil {
+		auth.mutex.Lock()
+		auth.store = login.Store
+		auth.mutex.Unlock()
+	}
+	results := make(chan pkceResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(ru.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		// browsers ask for /favicon.ico and the like, which mustn't end
+		// the login; only a request that looks like spotify's redirect can
+		if r.URL.Path != ru.Path || (q.Get("code") == "" && q.Get("error") == "" && q.Get("state") == "") {
+			http.NotFound(w, r)
+			return
+		}
+		var res pkceResult
+		if msg := q.Get("error"); msg != "" {
+			res.err = errors.Errorf("spotify authorization failed: %s", msg)
+		} else if q.Get("state") != state {
+			res.err = errors.New("spotify authorization state mismatch")
+		} else if q.Get("code") == "" {
+			res.err = errors.New("spotify authorization code missing")
+		} else {
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("Spotify login complete. You may close this window.\n"))
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+	defer srv.Close()
+	authURL := auth.AuthURLPKCE(state, PKCEChallenge(verifier), login.Scopes...)
+	if login.Open != nil {
+		err = login.Open(authURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't open spotify authorize url")
+		}
+	} else {
+		auth.log.Infof("visit this url to log in to spotify: %s", authURL)
+	}
+	timeout := login.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	var res pkceResult
+	select {
+	case res = <-results:
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for spotify authorization")
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	_, err = auth.ExchangePKCE(res.code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
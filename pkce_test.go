@@ -0,0 +1,186 @@
+package spotify_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+// follow is an Open hook that plays the browser: it visits the authorize
+// url and follows the redirect back to the loopback listener.
+func follow(authURL string) error {
+	res, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func pkceLogin(s *spotifytest.Server) spotify.PKCELogin {
+	return spotify.PKCELogin{
+		ClientID: spotifytest.ClientID,
+		RedirectURI: "http://127.0.0.1:0/callback",
+		Scopes: []string{spotify.ScopeUserReadPrivate},
+		AccountsURL: s.AccountsURL(),
+		Open: follow,
+		Timeout: 5 * time.Second,
+		Logger: spotify.NopLogger,
+	}
+}
+
+func TestLoginPKCE(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	store := spotify.NewMemoryTokenStore()
+	login := pkceLogin(s)
+	login.Store = store
+	auth, err := spotify.LoginPKCE(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := auth.Token()
+	if !tok.Valid() || tok.RefreshToken == "" {
+		t.Fatalf("got token %+v, want a valid token with a refresh token", tok)
+	}
+	if tok.Scope != spotify.ScopeUserReadPrivate {
+		t.Errorf("got scope %q, want %q", tok.Scope, spotify.ScopeUserReadPrivate)
+	}
+	saved, err := store.Load()
+	if err != nil || saved == nil || saved.AccessToken != tok.AccessToken {
+		t.Errorf("store has %+v, %v; want the new token", saved, err)
+	}
+	// the exchange must have proven the verifier rather than sent a secret
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "GET /authorize?") && !strings.Contains(req, "code_challenge_method=S256") {
+			t.Errorf("authorize request %s has no S256 challenge", req)
+		}
+	}
+	opts := s.ClientOptions()
+	opts.Auth = auth
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	market, err := c.Market()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if market != "US" {
+		t.Errorf("got market %q, want US", market)
+	}
+	err = auth.Refresh()
+	if err != nil {
+		t.Fatalf("can't refresh pkce token without a secret: %s", err)
+	}
+}
+
+func TestLoginPKCEStateMismatch(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	login := pkceLogin(s)
+	login.Open = func(authURL string) error {
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := client.Get(authURL)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		u, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		q.Set("state", "forged")
+		u.RawQuery = q.Encode()
+		go follow(u.String())
+		return nil
+	}
+	_, err := spotify.LoginPKCE(login)
+	if err == nil || !strings.Contains(err.Error(), "state mismatch") {
+		t.Fatalf("got error %v, want a state mismatch", err)
+	}
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "POST /api/token") {
+			t.Errorf("code was exchanged despite the state mismatch")
+		}
+	}
+}
+
+func TestLoginPKCETimeout(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	login := pkceLogin(s)
+	login.Open = func(authURL string) error { return nil }
+	login.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := spotify.LoginPKCE(login)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("got error %v, want a timeout", err)
+	}
+	if time.Since(start) > 2 * time.Second {
+		t.Errorf("took %s to time out", time.Since(start))
+	}
+}
+
+func TestExchangePKCEVerifier(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	verifier, err := spotify.NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := spotify.NewPKCEAuth(spotifytest.ClientID, "http://127.0.0.1/callback")
+	auth.SetAccountsURL(s.AccountsURL())
+	auth.SetLogger(spotify.NopLogger, false)
+	code := s.IssuePKCECode(spotify.PKCEChallenge(verifier))
+	_, err = auth.ExchangePKCE(code, verifier + "x")
+	if err == nil {
+		t.Fatal("exchanged code with the wrong verifier")
+	}
+	code = s.IssuePKCECode(spotify.PKCEChallenge(verifier))
+	_, err = auth.ExchangePKCE(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginPKCEIgnoresStrayRequests(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	login := pkceLogin(s)
+	login.RedirectURI = "http://127.0.0.1:0"
+	login.Open = func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		callback := strings.TrimSuffix(u.Query().Get("redirect_uri"), "/")
+		for _, stray := range []string{callback + "/favicon.ico", callback + "/", callback + "/?foo=bar"} {
+			res, err := http.Get(stray)
+			if err != nil {
+				return err
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusNotFound {
+				return errors.Errorf("got %s for %s, want 404", res.Status, stray)
+			}
+		}
+		return follow(authURL)
+	}
+	_, err := spotify.LoginPKCE(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package spotify
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/apiclient"
+	"github.com/rclancey/cache"
+)
+
+// AuthFunc returns the authenticator for a user, typically a *UserAuth
+// backed by a TokenStore holding that user's credentials.
+type AuthFunc func(userId string) (apiclient.Authenticator, error)
+
+// ClientPool hands out per-user clients.  All of its clients share one
+// rate limiter and one cache for catalog responses, while each user's
+// own resources are cached separately.  Clients that haven't been used
+// for IdleTimeout are evicted.
+type ClientPool struct {
+	// IdleTimeout defaults to 30 minutes.  If it isn't positive, clients
+	// are never evicted.
+	IdleTimeout time.Duration
+	opts ClientOptions
+	newAuth AuthFunc
+	http *httpClient
+	cache *responseCache
+	mutex sync.Mutex
+	clients map[string]*pooledClient
+	lastEvict time.Time
+}
+
+type pooledClient struct {
+	client *SpotifyClient
+	lastUsed time.Time
+}
+
+func NewClientPool(opts ClientOptions, newAuth AuthFunc) (*ClientPool, error) {
+	err := opts.setDefaults()
+	if err != nil {
+		return nil, err
+	}
+	hc := newHTTPClient(opts)
+	p := &ClientPool{
+		IdleTimeout: 30 * time.Minute,
+		opts: opts,
+		newAuth: newAuth,
+		http: hc,
+		cache: newResponseCache(opts.CacheStore, hc, opts.MaxResponseSize),
+		clients: map[string]*pooledClient{},
+		lastEvict: time.Now(),
+	}
+	return p, nil
+}
+
+func (p *ClientPool) Get(userId string) (*SpotifyClient, error) {
+	client, ok := p.lookup(userId)
+	if ok {
+		return client, nil
+	}
+	// newAuth may load tokens from slow storage, so it runs without the
+	// lock and a client created meanwhile by another caller wins
+	auth, err := p.newAuth(userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify auth for user " + userId)
+	}
+	opts := p.opts
+	opts.Auth = auth
+	private := newResponseCache(&prefixCacheStore{store: opts.CacheStore, prefix: userCachePrefix(userId)}, p.http, opts.MaxResponseSize)
+	client, err = newSpotifyClient(opts, p.http, p.cache, private)
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	pc, ok := p.clients[userId]
+	if ok {
+		pc.lastUsed = now
+		return pc.client, nil
+	}
+	p.clients[userId] = &pooledClient{client: client, lastUsed: now}
+	return client, nil
+}
+
+// lookup returns the pooled client for userId, if there is one, evicting
+// idle clients along the way.
+func (p *ClientPool) lookup(userId string) (*SpotifyClient, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	if p.IdleTimeout > 0 && now.Sub(p.lastEvict) > p.IdleTimeout / 2 {
+		p.evict(now)
+	}
+	pc, ok := p.clients[userId]
+	if !ok {
+		return nil, false
+	}
+	pc.lastUsed = now
+	return pc.client, true
+}
+
+func (p *ClientPool) RateLimiter() *RateLimiter {
+	return p.http.limiter
+}
+
+func (p *ClientPool) Remove(userId string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.clients, userId)
+}
+
+func (p *ClientPool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.clients)
+}
+
+// EvictIdle drops clients that haven't been used for IdleTimeout and
+// returns how many were dropped.  Get also does this periodically.
+func (p *ClientPool) EvictIdle() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.evict(time.Now())
+}
+
+func (p *ClientPool) evict(now time.Time) int {
+	if p.IdleTimeout <= 0 {
+		return 0
+	}
+	n := 0
+	for userId, pc := range p.clients {
+		if now.Sub(pc.lastUsed) > p.IdleTimeout {
+			delete(p.clients, userId)
+			n += 1
+		}
+	}
+	p.lastEvict = now
+	return n
+}
+
+func userCachePrefix(userId string) string {
+	sum := sha1.Sum([]byte(userId))
+	return path.Join("users", hex.EncodeToString(sum[:]))
+}
+
+// prefixCacheStore keeps one user's entries apart from everyone else's in
+// a shared cache store.
+type prefixCacheStore struct {
+	store cache.CacheStore
+	prefix string
+}
+
+func (s *prefixCacheStore) Open(name string, cacheTime time.Duration) (cache.CacheFile, error) {
+	return s.store.Open(path.Join(s.prefix, name), cacheTime)
+}
+
+func (s *prefixCacheStore) Delete(name string) error {
+	return s.store.Delete(path.Join(s.prefix, name))
+}
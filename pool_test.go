@@ -0,0 +1,75 @@
+package spotify_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclancey/apiclient"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func TestClientPoolSlowAuth(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	release := make(chan struct{})
+	pool, err := spotify.NewClientPool(s.ClientOptions(), func(userId string) (apiclient.Authenticator, error) {
+		if userId == "slow" {
+			<-release
+		}
+		auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback")
+		auth.SetAccountsURL(s.AccountsURL())
+		return auth, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := make(chan *spotify.SpotifyClient, 2)
+	for i := 0; i < 2; i += 1 {
+		go func() {
+			c, _ := pool.Get("slow")
+			slow <- c
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		pool.Get("fast")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Get blocked behind another user's auth")
+	}
+	close(release)
+	a, b := <-slow, <-slow
+	if a == nil || a != b {
+		t.Errorf("concurrent Gets returned clients %p and %p, want the same one", a, b)
+	}
+	if pool.Len() != 2 {
+		t.Errorf("pool has %d clients, want 2", pool.Len())
+	}
+}
+
+func TestClientPoolNoIdleTimeout(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	pool, err := spotify.NewClientPool(s.ClientOptions(), func(userId string) (apiclient.Authenticator, error) {
+		return spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.IdleTimeout = 0
+	a, err := pool.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	pool.Get("bob")
+	b, _ := pool.Get("alice")
+	if a != b || pool.Len() != 2 || pool.EvictIdle() != 0 {
+		t.Errorf("pool with no idle timeout evicted clients")
+	}
+}
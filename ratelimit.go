@@ -0,0 +1,139 @@
+package spotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	rateRampInterval = 5 * time.Second
+	rateRampSteps = 20
+	minRateFraction = 0.05
+)
+
+// RateLimiter spaces requests out to at most its current rate, shared by
+// every goroutine using it.  When spotify responds with a 429, Throttle
+// pauses all callers for the Retry-After window and halves the rate, which
+// then creeps back up to the maximum while no more 429s arrive.
+type RateLimiter struct {
+	mutex sync.Mutex
+	maxRate float64
+	rate float64
+	next time.Time
+	pausedUntil time.Time
+	lastAdjust time.Time
+	throttles int
+}
+
+type RateLimiterState struct {
+	Rate float64 `json:"rate"`
+	MaxRate float64 `json:"max_rate"`
+	PausedUntil time.Time `json:"paused_until"`
+	Throttles int `json:"throttles"`
+}
+
+// NewRateLimiter creates a limiter allowing up to maxRate requests per
+// second.  If maxRate isn't positive, requests are only held back while
+// throttled.
+func NewRateLimiter(maxRate float64) *RateLimiter {
+	return &RateLimiter{
+		maxRate: maxRate,
+		rate: maxRate,
+		lastAdjust: time.Now(),
+	}
+}
+
+// ramp raises the rate by one step per rateRampInterval since the last
+// adjustment.  Callers must hold the mutex.
+func (l *RateLimiter) ramp(now time.Time) {
+	if l.rate >= l.maxRate {
+		l.lastAdjust = now
+		return
+	}
+	steps := int(now.Sub(l.lastAdjust) / rateRampInterval)
+	if steps <= 0 {
+		return
+	}
+	l.rate += float64(steps) * l.maxRate / rateRampSteps
+	if l.rate > l.maxRate {
+		l.rate = l.maxRate
+	}
+	l.lastAdjust = l.lastAdjust.Add(time.Duration(steps) * rateRampInterval)
+}
+
+// reserve claims the next request slot and returns how long to wait for
+// it.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	t := now
+	if l.pausedUntil.After(t) {
+		t = l.pausedUntil
+	}
+	if l.maxRate > 0 {
+		l.ramp(now)
+		if l.next.After(t) {
+			t = l.next
+		}
+		l.next = t.Add(time.Duration(float64(time.Second) / l.rate))
+	}
+	return t.Sub(now)
+}
+
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		err := sleepContext(ctx, delay)
+		if err != nil {
+			return err
+		}
+		// a throttle may have come in while we slept
+		if !l.paused() {
+			return nil
+		}
+	}
+}
+
+func (l *RateLimiter) paused() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.pausedUntil.After(time.Now())
+}
+
+// Throttle pauses all callers for wait and halves the current rate.
+func (l *RateLimiter) Throttle(wait time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	until := now.Add(wait)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	if l.maxRate > 0 {
+		l.rate /= 2
+		if l.rate < l.maxRate * minRateFraction {
+			l.rate = l.maxRate * minRateFraction
+		}
+	}
+	l.lastAdjust = now
+	l.throttles += 1
+}
+
+func (l *RateLimiter) State() RateLimiterState {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.maxRate > 0 {
+		l.ramp(time.Now())
+	}
+	return RateLimiterState{
+		Rate: l.rate,
+		MaxRate: l.maxRate,
+		PausedUntil: l.pausedUntil,
+		Throttles: l.throttles,
+	}
+}
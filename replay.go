@@ -0,0 +1,208 @@
+package spotify
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnmatchedRequest = errors.New("no recorded response for request")
+
+type ReplayMode int
+
+const (
+	// ReplayModeReplay serves recorded responses and fails any request
+	// that wasn't recorded.
+	ReplayModeReplay ReplayMode = iota
+	// ReplayModeRecord passes requests through and records them.
+	ReplayModeRecord
+)
+
+// ReplayTransport records request/response pairs to fixture files and
+// serves them back.  Set it as ClientOptions.Transport so that both api
+// and accounts requests go through it.  Credentials are scrubbed from
+// the fixtures, so replayed token responses carry placeholder tokens.
+// Identical requests are replayed in the order they were recorded, with
+// the last response repeated once they run out.
+type ReplayTransport struct {
+	Mode ReplayMode
+	Dir string
+	// Transport makes the real requests when recording.  It defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	mutex sync.Mutex
+	counts map[string]int
+	unmatched []string
+}
+
+type Fixture struct {
+	Method string `json:"method"`
+	URL string `json:"url"`
+	RequestHeader http.Header `json:"request_header,omitempty"`
+	RequestBody string `json:"request_body,omitempty"`
+	Status int `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+}
+
+func NewRecordingTransport(dir string, transport http.RoundTripper) *ReplayTransport {
+	return &ReplayTransport{Mode: ReplayModeRecord, Dir: dir, Transport: transport}
+}
+
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{Mode: ReplayModeReplay, Dir: dir}
+}
+
+// Unmatched returns the requests that had no recorded response.
+func (t *ReplayTransport) Unmatched() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string{}, t.unmatched...)
+}
+
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range scrubbedHeaders {
+		h.Del(k)
+	}
+	return h
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read request body")
+		}
+		reqBody = data
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	scrubbed := Redact(string(reqBody))
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String() + "\n" + scrubbed))
+	key := hex.EncodeToString(sum[:])[:16]
+	t.mutex.Lock()
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	n := t.counts[key]
+	t.counts[key] = n + 1
+	t.mutex.Unlock()
+	if t.Mode == ReplayModeRecord {
+		return t.record(req, scrubbed, key, n)
+	}
+	return t.replay(req, key, n)
+}
+
+func (t *ReplayTransport) fixturePath(key string, n int) string {
+	return filepath.Join(t.Dir, fmt.Sprintf("%s-%03d.json", key, n))
+}
+
+func (t *ReplayTransport) record(req *http.Request, reqBody, key string, n int) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read response body")
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	fix := &Fixture{
+		Method: req.Method,
+		URL: req.URL.String(),
+		RequestHeader: scrubHeader(req.Header),
+		RequestBody: reqBody,
+		Status: res.StatusCode,
+		Header: scrubHeader(res.Header),
+	}
+	fix.Header.Del("Content-Length")
+	if utf8.Valid(data) {
+		fix.Body = Redact(string(data))
+	} else {
+		fix.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+	}
+	js, err := json.MarshalIndent(fix, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't marshal fixture")
+	}
+	err = os.MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create fixture directory " + t.Dir)
+	}
+	fn := t.fixturePath(key, n)
+	err = ioutil.WriteFile(fn, js, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't write fixture " + fn)
+	}
+	return res, nil
+}
+
+func (t *ReplayTransport) replay(req *http.Request, key string, n int) (*http.Response, error) {
+	var data []byte
+	var err error
+	for i := n; i >= 0; i -= 1 {
+		data, err = ioutil.ReadFile(t.fixturePath(key, i))
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		desc := req.Method + " " + req.URL.String()
+		t.mutex.Lock()
+		t.unmatched = append(t.unmatched, desc)
+		t.mutex.Unlock()
+		if os.IsNotExist(err) {
+			return nil, errors.Wrap(ErrUnmatchedRequest, desc)
+		}
+		return nil, errors.Wrap(err, "can't read fixture for " + desc)
+	}
+	fix := &Fixture{}
+	err = json.Unmarshal(data, fix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't unmarshal fixture for %s %s", req.Method, req.URL)
+	}
+	body := []byte(fix.Body)
+	if fix.BodyBase64 != "" {
+		body, err = base64.StdEncoding.DecodeString(fix.BodyBase64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't decode fixture body for %s %s", req.Method, req.URL)
+		}
+	}
+	header := fix.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	res := &http.Response{
+		Status: fmt.Sprintf("%d %s", fix.Status, http.StatusText(fix.Status)),
+		StatusCode: fix.Status,
+		Proto: "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: header,
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request: req,
+	}
+	return res, nil
+}
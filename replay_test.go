@@ -0,0 +1,117 @@
+package spotify_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+// secretCatcher notes every credential that passes through it, so the
+// test can look for them in the fixtures.
+type secretCatcher struct {
+	mutex sync.Mutex
+	secrets []string
+}
+
+func (sc *secretCatcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sc.secrets = append(sc.secrets, strings.Fields(auth)[1])
+	}
+	tok := map[string]interface{}{}
+	if json.Unmarshal(data, &tok) == nil {
+		for _, k := range []string{"access_token", "refresh_token"} {
+			if v, ok := tok[k].(string); ok {
+				sc.secrets = append(sc.secrets, v)
+			}
+		}
+	}
+	return res, nil
+}
+
+func TestReplayTransport(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := spotifytest.NewServer()
+	tr := s.AddTrack(&spotify.Track{Name: "Recorded"})
+	catcher := &secretCatcher{}
+	opts := s.ClientOptions()
+	opts.Transport = spotify.NewRecordingTransport(dir, catcher)
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("recorded %d fixtures, want a token and a track", len(files))
+	}
+	if len(catcher.secrets) < 3 {
+		t.Fatalf("saw credentials %v, want client credentials and a token", catcher.secrets)
+	}
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("Authorization")) {
+			t.Errorf("%s has an Authorization header", fn)
+		}
+		for _, secret := range catcher.secrets {
+			if bytes.Contains(data, []byte(secret)) {
+				t.Errorf("%s has credential %s", fn, secret)
+			}
+		}
+	}
+
+	replay := spotify.NewReplayTransport(dir)
+	opts.Transport = replay
+	c, err = spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Recorded" {
+		t.Errorf("replayed track %+v", got)
+	}
+	_, err = c.GetTrack("unrecorded")
+	if !errors.Is(err, spotify.ErrUnmatchedRequest) {
+		t.Fatalf("got error %v, want ErrUnmatchedRequest", err)
+	}
+	unmatched := replay.Unmatched()
+	if len(unmatched) != 1 || !strings.HasSuffix(unmatched[0], "/tracks/unrecorded") {
+		t.Errorf("got unmatched requests %v", unmatched)
+	}
+}
@@ -0,0 +1,237 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultMaxRetryWait = 2 * time.Minute
+	defaultMaxResponseSize = 16 * 1024 * 1024
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// ErrResponseTooLarge is returned, without retrying, for responses bigger
+// than ClientOptions.MaxResponseSize.
+var ErrResponseTooLarge = errors.New("spotify response too large")
+
+type response struct {
+	data []byte
+	header http.Header
+}
+
+// execute sends a request with send and reports it to the observer, if
+// any.
+func (c *apiClient) execute(ctx context.Context, endpoint string, send func(ctx context.Context) (*http.Response, error)) (*response, error) {
+	start := time.Now()
+	ctx, stats := withRequestStats(ctx)
+	res, status, retries, err := c.retry(ctx, endpoint, send)
+	if c.observer != nil {
+		stats.mutex.Lock()
+		info := &RequestInfo{
+			Endpoint: endpointTemplate(endpoint),
+			Method: http.MethodGet,
+			Status: status,
+			Latency: time.Since(start),
+			Retries: retries,
+			CacheHit: err == nil && stats.sent == 0,
+			Revalidated: err == nil && stats.revalidated,
+			RateLimitWait: stats.rateLimitWait,
+			Err: err,
+		}
+		stats.mutex.Unlock()
+		c.observer.ObserveRequest(info)
+	}
+	return res, err
+}
+
+// retry sends a request with send, retrying rate limited responses after
+// the Retry-After delay, and server errors and transport errors with
+// exponential backoff, until it either succeeds, gets any other error,
+// runs out of retries or would wait longer than maxRetryWait in total.
+// It returns the final status and the number of retries.
+func (c *apiClient) retry(ctx context.Context, endpoint string, send func(ctx context.Context) (*http.Response, error)) (*response, int, int, error) {
+	start := time.Now()
+	attempt := 0
+	for {
+		var wait time.Duration
+		var lastErr error
+		throttled := false
+		status := 0
+		res, err := send(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, status, attempt, ctx.Err()
+			}
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				return nil, apiErr.Status, attempt, err
+			}
+			if errors.Is(err, ErrUnmatchedRequest) || errors.Is(err, ErrResponseTooLarge) {
+				return nil, status, attempt, err
+			}
+			// only failures to reach spotify are worth retrying; auth, cache
+			// and url errors would just fail again
+			var netErr net.Error
+			if !errors.As(err, &netErr) {
+				return nil, status, attempt, err
+			}
+			lastErr = errors.Wrap(err, "can't execute spotify request")
+			wait = backoff(attempt)
+		} else if res.StatusCode == http.StatusOK {
+			data, err := c.readResponse(res, endpoint)
+			return data, res.StatusCode, attempt, err
+		} else {
+			status = res.StatusCode
+			apiErr := newAPIError(res, endpoint)
+			switch {
+			case res.StatusCode == http.StatusTooManyRequests:
+				secs, err := strconv.Atoi(res.Header.Get("Retry-After"))
+				if err == nil {
+					wait = time.Duration(secs + 1) * time.Second
+				} else {
+					wait = backoff(attempt)
+				}
+				// the limiter holds back every caller, including this one,
+				// and has to hear about the 429 even if this request gives up
+				c.client.limiter.Throttle(wait)
+				throttled = true
+			case res.StatusCode >= 500:
+				wait = backoff(attempt)
+			default:
+				return nil, status, attempt, apiErr
+			}
+			lastErr = apiErr
+		}
+		if attempt + 1 > c.maxRetries || time.Since(start) + wait > c.maxRetryWait {
+			return nil, status, attempt, lastErr
+		}
+		attempt += 1
+		c.log.Warnf("%s: %s; retrying in %s", endpoint, lastErr, wait)
+		if throttled {
+			continue
+		}
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return nil, status, attempt, err
+		}
+	}
+}
+
+func (c *apiClient) readResponse(res *http.Response, endpoint string) (*response, error) {
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, c.maxResponseSize + 1))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read spotify response from " + endpoint)
+	}
+	if int64(len(data)) > c.maxResponseSize {
+		return nil, errors.Wrapf(ErrResponseTooLarge, "response from %s exceeds %d bytes", endpoint, c.maxResponseSize)
+	}
+	return &response{data: data, header: res.Header}, nil
+}
+
+// backoff returns a jittered exponential delay for the given attempt.
+func backoff(attempt int) time.Duration {
+	d := maxBackoff
+	if attempt < 16 {
+		d = minBackoff << uint(attempt)
+		if d > maxBackoff {
+			d = maxBackoff
+		}
+	}
+	return d / 2 + time.Duration(rand.Int63n(int64(d / 2) + 1))
+}
+
+type marketKey struct{}
+
+// WithMarket returns a context that makes the catalog calls it's passed to
+// (GetTrack, GetTracks, GetAlbum, GetAlbums and Album.GetTracks) ask for
+// content as available in market, an ISO 3166-1 country code or
+// "from_token" for the current user's country.  Only then does spotify
+// relink unplayable tracks and fill in LinkedFrom, IsPlayable and
+// Restrictions.
+func WithMarket(ctx context.Context, market string) context.Context {
+	return context.WithValue(ctx, marketKey{}, market)
+}
+
+// marketArgs returns query args with the market from ctx, if any.
+func marketArgs(ctx context.Context) url.Values {
+	q := url.Values{}
+	if market, _ := ctx.Value(marketKey{}).(string); market != "" {
+		q.Set("market", market)
+	}
+	return q
+}
+
+// getSeveral fetches objects by id from one of the "several" endpoints,
+// sending at most max ids per request along with args, and returns the
+// raw json of each object that was found, keyed by id.  key is the field
+// of the response that holds the objects.  Empty and repeated ids aren't
+// sent.  Callers return the objects in the same order as the ids, with nil
+// for ids spotify doesn't know.
+func (c *apiClient) getSeveral(ctx context.Context, rsrc, key string, ids []string, max int, args url.Values) (map[string]json.RawMessage, error) {
+	found := map[string]json.RawMessage{}
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	for len(unique) > 0 {
+		n := max
+		if n > len(unique) {
+			n = len(unique)
+		}
+		chunk := unique[:n]
+		unique = unique[n:]
+		q := url.Values{}
+		for k, v := range args {
+			q[k] = v
+		}
+		q.Set("ids", strings.Join(chunk, ","))
+		res := map[string][]json.RawMessage{}
+		err := c.getJSON(ctx, rsrc, q, &res)
+		if err != nil {
+			return nil, err
+		}
+		// objects come back in the order they were asked for, with null
+		// for unknown ids
+		for i, data := range res[key] {
+			if i < len(chunk) && string(data) != "null" {
+				found[chunk[i]] = data
+			}
+		}
+	}
+	return found, nil
+}
+
+// getJSON fetches an api resource and unmarshals the json response into
+// obj.
+func (c *apiClient) getJSON(ctx context.Context, rsrc string, q url.Values, obj interface{}) error {
+	res, err := c.execute(ctx, rsrc, func(ctx context.Context) (*http.Response, error) {
+		return c.GetContext(ctx, rsrc, q)
+	})
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(res.data, obj)
+	if err != nil {
+		return errors.Wrapf(err, "can't unmarshal spotify response into %T", obj)
+	}
+	return nil
+}
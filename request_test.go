@@ -0,0 +1,274 @@
+package spotify_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func TestThrottleWithoutRetry(t *testing.T) {
+	tests := map[string]func(opts *spotify.ClientOptions){
+		"retry after too long": func(opts *spotify.ClientOptions) {
+			opts.MaxRetryWait = time.Second
+		},
+		"retries disabled": func(opts *spotify.ClientOptions) {
+			opts.MaxRetries = -1
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := spotifytest.NewServer()
+			defer s.Close()
+			s.Fail(spotifytest.Failure{Path: "/v1/tracks", Status: 429, RetryAfter: 3600})
+			opts := s.ClientOptions()
+			configure(&opts)
+			c, err := spotify.NewSpotifyClientWithOptions(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			_, err = c.GetTrack("track1")
+			if err == nil {
+				t.Fatal("rate limited request succeeded")
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("took %s to give up", time.Since(start))
+			}
+			state := c.RateLimiter().State()
+			if state.Throttles != 1 {
+				t.Errorf("limiter saw %d throttles, want 1", state.Throttles)
+			}
+			if time.Until(state.PausedUntil) < time.Hour {
+				t.Errorf("limiter paused until %s, want an hour from now", state.PausedUntil)
+			}
+		})
+	}
+}
+
+func TestMaxResponseSizeWhenCaching(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tr := s.AddTrack(&spotify.Track{Name: strings.Repeat("long name ", 100)})
+	opts := s.ClientOptions()
+	opts.CacheStore = spotifytest.NewMemoryCacheStore()
+	opts.MaxResponseSize = 512
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = c.GetTrack(tr.ID)
+	if !errors.Is(err, spotify.ErrResponseTooLarge) {
+		t.Fatalf("got error %v, want ErrResponseTooLarge", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("took %s to give up on an oversized response", time.Since(start))
+	}
+}
+
+func TestNoRetryWithoutTransportError(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	var retries []int
+	opts := s.ClientOptions()
+	opts.Observer = spotify.ObserverFunc(func(info *spotify.RequestInfo) {
+		retries = append(retries, info.Retries)
+	})
+	auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback")
+	auth.SetAccountsURL(s.AccountsURL())
+	opts.Auth = auth
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = c.CurrentUser()
+	if !errors.Is(err, spotify.ErrNotAuthorized) {
+		t.Fatalf("got error %v, want ErrNotAuthorized", err)
+	}
+	if time.Since(start) > time.Second || len(retries) != 1 || retries[0] != 0 {
+		t.Errorf("took %s and %v retries to fail without a token", time.Since(start), retries)
+	}
+}
+
+func TestRetryTransportError(t *testing.T) {
+	s := spotifytest.NewServer()
+	s.Close()
+	var retries []int
+	opts := s.ClientOptions()
+	opts.MaxRetries = 1
+	opts.Observer = spotify.ObserverFunc(func(info *spotify.RequestInfo) {
+		retries = append(retries, info.Retries)
+	})
+	auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback")
+	auth.SetToken(&spotify.Token{AccessToken: "token", TokenType: "Bearer", Expires: time.Now().Add(time.Hour)})
+	opts.Auth = auth
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CurrentUser()
+	if err == nil {
+		t.Fatal("got a user from a closed server")
+	}
+	if len(retries) != 1 || retries[0] != 1 {
+		t.Errorf("got %v retries for an unreachable server, want 1", retries)
+	}
+}
+
+// severalKind adds n objects of one kind to the server and fetches
+// objects of that kind by id, returning "" for any that come back nil.
+type severalKind struct {
+	rsrc string
+	max int
+	add func(s *spotifytest.Server, n int) []string
+	get func(c *spotify.SpotifyClient, ids []string) ([]string, error)
+}
+
+var severalKinds = []severalKind{
+	{
+		rsrc: "tracks",
+		max: 50,
+		add: func(s *spotifytest.Server, n int) []string {
+			ids := make([]string, n)
+			for i := range ids {
+				ids[i] = s.AddTrack(&spotify.Track{Name: fmt.Sprintf("Track %d", i)}).ID
+			}
+			return ids
+		},
+		get: func(c *spotify.SpotifyClient, ids []string) ([]string, error) {
+			objs, err := c.GetTracks(ids...)
+			got := make([]string, len(objs))
+			for i, obj := range objs {
+				if obj != nil {
+					got[i] = obj.ID
+				}
+			}
+			return got, err
+		},
+	},
+	{
+		rsrc: "albums",
+		max: 20,
+		add: func(s *spotifytest.Server, n int) []string {
+			ids := make([]string, n)
+			for i := range ids {
+				ids[i] = s.AddAlbum(&spotify.Album{Name: fmt.Sprintf("Album %d", i)}).ID
+			}
+			return ids
+		},
+		get: func(c *spotify.SpotifyClient, ids []string) ([]string, error) {
+			objs, err := c.GetAlbums(ids...)
+			got := make([]string, len(objs))
+			for i, obj := range objs {
+				if obj != nil {
+					got[i] = obj.ID
+				}
+			}
+			return got, err
+		},
+	},
+	{
+		rsrc: "artists",
+		max: 50,
+		add: func(s *spotifytest.Server, n int) []string {
+			ids := make([]string, n)
+			for i := range ids {
+				ids[i] = s.AddArtist(&spotify.Artist{Name: fmt.Sprintf("Artist %d", i)}).ID
+			}
+			return ids
+		},
+		get: func(c *spotify.SpotifyClient, ids []string) ([]string, error) {
+			objs, err := c.GetArtists(ids...)
+			got := make([]string, len(objs))
+			for i, obj := range objs {
+				if obj != nil {
+					got[i] = obj.ID
+				}
+			}
+			return got, err
+		},
+	},
+	{
+		rsrc: "audio-features",
+		max: 100,
+		add: func(s *spotifytest.Server, n int) []string {
+			ids := make([]string, n)
+			for i := range ids {
+				ids[i] = fmt.Sprintf("features%d", i)
+				s.SetAudioFeatures(&spotify.AudioFeatures{ID: ids[i]})
+			}
+			return ids
+		},
+		get: func(c *spotify.SpotifyClient, ids []string) ([]string, error) {
+			objs, err := c.GetAudioFeatures(ids...)
+			got := make([]string, len(objs))
+			for i, obj := range objs {
+				if obj != nil {
+					got[i] = obj.ID
+				}
+			}
+			return got, err
+		},
+	},
+}
+
+func TestGetSeveralChunks(t *testing.T) {
+	for _, kind := range severalKinds {
+		// known is how many known ids to ask for, and requests how many
+		// requests that takes once an unknown id is added
+		for _, n := range []struct{ known, requests int }{
+			{kind.max - 1, 1},
+			{kind.max, 2},
+			{2 * kind.max - 1, 2},
+			{2 * kind.max, 3},
+		} {
+			t.Run(fmt.Sprintf("%s/%d", kind.rsrc, n.known), func(t *testing.T) {
+				s := spotifytest.NewServer()
+				defer s.Close()
+				known := kind.add(s, n.known)
+				// an unknown id in the middle, and repeats of the first id
+				// and the unknown one at the end, which aren't sent again
+				ids := append([]string{}, known[:n.known / 2]...)
+				ids = append(ids, "unknown")
+				ids = append(ids, known[n.known / 2:]...)
+				ids = append(ids, known[0], "unknown", "")
+				c, err := s.NewClient()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := kind.get(c, ids)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(ids) {
+					t.Fatalf("got %d objects for %d ids", len(got), len(ids))
+				}
+				for i, id := range ids {
+					want := id
+					if id == "unknown" {
+						want = ""
+					}
+					if got[i] != want {
+						t.Errorf("object %d is %q, want %q", i, got[i], want)
+					}
+				}
+				sent := 0
+				for _, req := range s.Requests() {
+					if strings.HasPrefix(req, "GET /v1/" + kind.rsrc + "?") {
+						sent += 1
+					}
+				}
+				if sent != n.requests {
+					t.Errorf("sent %d requests, want %d", sent, n.requests)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package spotify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ScopeUGCImageUpload = "ugc-image-upload"
+	ScopeUserReadPlaybackState = "user-read-playback-state"
+	ScopeUserModifyPlaybackState = "user-modify-playback-state"
+	ScopeUserReadCurrentlyPlaying = "user-read-currently-playing"
+	ScopeAppRemoteControl = "app-remote-control"
+	ScopeStreaming = "streaming"
+	ScopePlaylistReadPrivate = "playlist-read-private"
+	ScopePlaylistReadCollaborative = "playlist-read-collaborative"
+	ScopePlaylistModifyPrivate = "playlist-modify-private"
+	ScopePlaylistModifyPublic = "playlist-modify-public"
+	ScopeUserFollowModify = "user-follow-modify"
+	ScopeUserFollowRead = "user-follow-read"
+	ScopeUserReadPlaybackPosition = "user-read-playback-position"
+	ScopeUserTopRead = "user-top-read"
+	ScopeUserReadRecentlyPlayed = "user-read-recently-played"
+	ScopeUserLibraryModify = "user-library-modify"
+	ScopeUserLibraryRead = "user-library-read"
+	ScopeUserReadEmail = "user-read-email"
+	ScopeUserReadPrivate = "user-read-private"
+)
+
+var ErrScopeMissing = errors.New("spotify token is missing required scopes")
+
+// ScopeMissingError is returned by user-scoped methods, before making any
+// request, when the token wasn't granted the scopes the method needs.
+type ScopeMissingError struct {
+	Method string
+	Missing []string
+}
+
+func (e *ScopeMissingError) Error() string {
+	return fmt.Sprintf("%s requires spotify scopes: %s", e.Method, strings.Join(e.Missing, " "))
+}
+
+func (e *ScopeMissingError) Is(target error) bool {
+	return target == ErrScopeMissing
+}
+
+// ScopedAuth is implemented by authenticators that know which scopes
+// their token was granted.
+type ScopedAuth interface {
+	GrantedScopes() []string
+}
+
+func (c *ClientAuth) GrantedScopes() []string {
+	return []string{}
+}
+
+func (a *UserAuth) GrantedScopes() []string {
+	return a.Token().Scopes()
+}
+
+// GrantedScopes returns the scopes granted to the client's token, or nil
+// if the authenticator doesn't report them.
+func (c *SpotifyClient) GrantedScopes() []string {
+	sa, ok := c.client.auth.(ScopedAuth)
+	if !ok {
+		return nil
+	}
+	return sa.GrantedScopes()
+}
+
+func (c *SpotifyClient) HasScopes(scopes ...string) bool {
+	granted := c.GrantedScopes()
+	if granted == nil {
+		return true
+	}
+	return len(missingScopes(granted, scopes)) == 0
+}
+
+// scopedMethod names a SpotifyClient method that needs scopes beyond a
+// user token.
+type scopedMethod string
+
+const (
+	methodIsPremium = scopedMethod("IsPremium")
+	methodMarket = scopedMethod("Market")
+)
+
+var methodScopes = map[scopedMethod][]string{
+	methodIsPremium: []string{ScopeUserReadPrivate},
+	methodMarket: []string{ScopeUserReadPrivate},
+}
+
+// MethodScopes returns the scopes the named SpotifyClient method needs,
+// or nil if it needs none beyond a user token.
+func MethodScopes(method string) []string {
+	scopes, ok := methodScopes[scopedMethod(method)]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, scopes...)
+}
+
+// requireScopes fails with a *ScopeMissingError if the token lacks any of
+// the scopes method needs.  If the authenticator doesn't report its
+// scopes, the request is let through and spotify gets to decide.
+func (c *SpotifyClient) requireScopes(method scopedMethod) error {
+	scopes := methodScopes[method]
+	granted := c.GrantedScopes()
+	if granted == nil {
+		return nil
+	}
+	missing := missingScopes(granted, scopes)
+	if len(missing) > 0 {
+		return &ScopeMissingError{Method: string(method), Missing: missing}
+	}
+	return nil
+}
+
+func missingScopes(granted, required []string) []string {
+	have := map[string]bool{}
+	for _, scope := range granted {
+		have[scope] = true
+	}
+	missing := []string{}
+	for _, scope := range required {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+type Feature string
+
+const (
+	FeatureProfile = Feature("profile")
+	FeatureEmail = Feature("email")
+	FeaturePlaylists = Feature("playlists")
+	FeatureEditPlaylists = Feature("edit-playlists")
+	FeatureLibrary = Feature("library")
+	FeatureEditLibrary = Feature("edit-library")
+	FeatureFollow = Feature("follow")
+	FeatureEditFollow = Feature("edit-follow")
+	FeatureTop = Feature("top")
+	FeatureRecentlyPlayed = Feature("recently-played")
+	FeaturePlayer = Feature("player")
+	FeatureControlPlayer = Feature("control-player")
+	FeatureStreaming = Feature("streaming")
+	FeatureImageUpload = Feature("image-upload")
+)
+
+var FeatureScopes = map[Feature][]string{
+	FeatureProfile: []string{ScopeUserReadPrivate},
+	FeatureEmail: []string{ScopeUserReadEmail},
+	FeaturePlaylists: []string{ScopePlaylistReadPrivate, ScopePlaylistReadCollaborative},
+	FeatureEditPlaylists: []string{ScopePlaylistModifyPrivate, ScopePlaylistModifyPublic},
+	FeatureLibrary: []string{ScopeUserLibraryRead},
+	FeatureEditLibrary: []string{ScopeUserLibraryModify},
+	FeatureFollow: []string{ScopeUserFollowRead},
+	FeatureEditFollow: []string{ScopeUserFollowModify},
+	FeatureTop: []string{ScopeUserTopRead},
+	FeatureRecentlyPlayed: []string{ScopeUserReadRecentlyPlayed, ScopeUserReadPlaybackPosition},
+	FeaturePlayer: []string{ScopeUserReadPlaybackState, ScopeUserReadCurrentlyPlaying},
+	FeatureControlPlayer: []string{ScopeUserModifyPlaybackState},
+	FeatureStreaming: []string{ScopeStreaming, ScopeUserReadEmail, ScopeUserReadPrivate},
+	FeatureImageUpload: []string{ScopeUGCImageUpload},
+}
+
+// ScopesFor returns the sorted union of the scopes needed by features,
+// suitable for passing to UserAuth.AuthURL.
+func ScopesFor(features ...Feature) []string {
+	set := map[string]bool{}
+	for _, f := range features {
+		for _, scope := range FeatureScopes[f] {
+			set[scope] = true
+		}
+	}
+	scopes := make([]string, 0, len(set))
+	for scope := range set {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
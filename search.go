@@ -1,13 +1,8 @@
 package spotify
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"context"
 	"net/url"
-	"strconv"
-	"time"
 
 	"github.com/pkg/errors"
 )
@@ -25,37 +20,20 @@ type SearchResult struct {
 }
 
 func (c *SpotifyClient) Search(name, kind string) (*SearchResult, error) {
+	return c.SearchContext(context.Background(), name, kind)
+}
+
+func (c *SpotifyClient) SearchContext(ctx context.Context, name, kind string) (*SearchResult, error) {
 	q := url.Values{}
 	q.Set("q", name)
 	q.Set("type", kind)
 	rsrc := "search"
 	result := &SearchResult{}
 	for {
-		res, err := c.client.Get(rsrc, q)
-		if err != nil {
-			return nil, errors.Wrap(err, "can't execute spotify search")
-		}
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			if res.StatusCode == http.StatusTooManyRequests {
-				wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
-				if err == nil {
-					log.Printf("API ratelimit; waiting %d seconds", wait)
-					time.Sleep(time.Duration(wait + 1) * time.Second)
-					continue
-				}
-			}
-			return nil, errors.New(res.Status)
-		}
-		data, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, errors.Wrap(err, "can't read spotify search response")
-		}
 		sr := &SearchResultPage{}
-		err = json.Unmarshal(data, sr)
+		err := c.client.getJSON(ctx, rsrc, q, sr)
 		if err != nil {
-			return nil, errors.Wrap(err, "can't unmarshal spotify search response")
+			return nil, errors.Wrap(err, "can't execute spotify search")
 		}
 		itemsets := []TypedItems{
 			sr.Artists.Items,
@@ -93,12 +71,10 @@ func (c *SpotifyClient) Search(name, kind string) (*SearchResult, error) {
 		if sr.Artists.NextHref == nil || *sr.Artists.NextHref == "" {
 			break
 		}
-		nu, err := url.Parse(*sr.Artists.NextHref)
+		rsrc, q, err = nextPage(*sr.Artists.NextHref)
 		if err != nil {
-			break
+			return nil, err
 		}
-		rsrc = nu.Path
-		q = nu.Query()
 		break
 	}
 	c.addClientToArtists(result.Artists...)
@@ -1,44 +1,238 @@
 package spotify
 
 import (
-	"io/ioutil"
+	"context"
 	//"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/rclancey/apiclient"
+	"github.com/rclancey/cache"
 	"github.com/rclancey/cache/fs"
 )
 
+const spotifyAPIURL = "https://api.spotify.com/v1/"
+
 type SpotifyClient struct {
-	client *apiclient.APIClient
+	client *apiClient
+	mutex sync.Mutex
+	// me is the current user's profile, once fetched
+	me *User
+}
+
+// RateLimiter returns the limiter shared by the client's requests, e.g.
+// to report its State.
+func (c *SpotifyClient) RateLimiter() *RateLimiter {
+	return c.client.client.limiter
+}
+
+// ClientOptions configures a SpotifyClient.  Zero values get the same
+// defaults NewSpotifyClient uses.
+type ClientOptions struct {
+	ClientID string
+	ClientSecret string
+	// Auth, if set, is used instead of client credentials auth with
+	// ClientID and ClientSecret.
+	Auth apiclient.Authenticator
+	BaseURL string
+	AccountsURL string
+	// HTTPClient, if set, is used for both api and accounts requests, and
+	// Transport, RequestTimeout and AuthTimeout are ignored.
+	HTTPClient *http.Client
+	Transport http.RoundTripper
+	RequestTimeout time.Duration
+	AuthTimeout time.Duration
+	MaxRequestsPerSecond float64
+	// RateLimiter, if set, is shared with other clients, and
+	// MaxRequestsPerSecond is ignored.
+	RateLimiter *RateLimiter
+	// CacheStore defaults to a file system cache in CacheDir.  Entries
+	// older than CacheTime are revalidated using their ETag, which relies
+	// on the store opening entries of any age when given a negative cache
+	// time, as the file system cache does.
+	CacheStore cache.CacheStore
+	CacheDir string
+	CacheTime time.Duration
+	// CachePolicies overrides CacheTime for particular endpoints.  It
+	// defaults to DefaultCachePolicies; set it to an empty map to cache
+	// everything for CacheTime.
+	CachePolicies CachePolicies
+	UserAgent string
+	// MaxRetries bounds how often a rate limited, failed or unreachable
+	// request is retried, and MaxRetryWait bounds the total time spent
+	// waiting to retry.  A negative MaxRetries disables retries.
+	MaxRetries int
+	MaxRetryWait time.Duration
+	MaxResponseSize int64
+	// Observer, if set, is told about every api call.
+	Observer Observer
+	// Logger defaults to DefaultLogger.  Tokens, codes and secrets are
+	// redacted from log messages unless LogSecrets is set.
+	Logger Logger
+	LogSecrets bool
 }
 
 func NewSpotifyClient(clientId, clientSecret, cacheDir string, cacheTime time.Duration) (*SpotifyClient, error) {
-	auth, err := NewClientAuth(clientId, clientSecret)
-	if err != nil {
-		return nil, errors.Wrap(err, "can't create spotify auth")
-	}
-	opts := apiclient.APIClientOptions{
-		BaseURL: "https://api.spotify.com/v1/",
-		RequestTimeout: 0,
-		CacheStore: fscache.NewFSCacheStore(cacheDir),
-		MaxCacheTime: cacheTime,
-		MaxRequestsPerSecond: 4.0,
+	return NewSpotifyClientWithOptions(ClientOptions{
+		ClientID: clientId,
+		ClientSecret: clientSecret,
+		CacheDir: cacheDir,
+		CacheTime: cacheTime,
+	})
+}
+
+// NewSpotifyClientWithAuth creates a client that authenticates its requests
+// with auth, e.g. a *UserAuth for user-scoped endpoints.
+func NewSpotifyClientWithAuth(auth apiclient.Authenticator, cacheDir string, cacheTime time.Duration) (*SpotifyClient, error) {
+	return NewSpotifyClientWithOptions(ClientOptions{
 		Auth: auth,
+		CacheDir: cacheDir,
+		CacheTime: cacheTime,
+	})
+}
+
+func NewSpotifyClientWithOptions(opts ClientOptions) (*SpotifyClient, error) {
+	err := opts.setDefaults()
+	if err != nil {
+		return nil, err
+	}
+	hc := newHTTPClient(opts)
+	return newSpotifyClient(opts, hc, newResponseCache(opts.CacheStore, hc, opts.MaxResponseSize), nil)
+}
+
+func (opts *ClientOptions) setDefaults() error {
+	if opts.BaseURL == "" {
+		opts.BaseURL = spotifyAPIURL
+	}
+	if opts.AccountsURL == "" {
+		opts.AccountsURL = spotifyAccountsURL
+	}
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = 5 * time.Second
+	}
+	if opts.AuthTimeout == 0 {
+		opts.AuthTimeout = 5 * time.Second
+	}
+	if opts.MaxRequestsPerSecond == 0 {
+		opts.MaxRequestsPerSecond = 4.0
+	}
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = NewRateLimiter(opts.MaxRequestsPerSecond)
+	}
+	if opts.CacheTime == 0 {
+		opts.CacheTime = 24 * time.Hour
+	}
+	if opts.CachePolicies == nil {
+		opts.CachePolicies = DefaultCachePolicies()
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	if opts.MaxRetryWait == 0 {
+		opts.MaxRetryWait = defaultMaxRetryWait
+	}
+	if opts.MaxResponseSize == 0 {
+		opts.MaxResponseSize = defaultMaxResponseSize
 	}
-	api, err := apiclient.NewAPIClient(opts)
+	if opts.CacheStore == nil {
+		if opts.CacheDir == "" {
+			pth, err := filepath.Abs(filepath.Join(".", "var", "cache"))
+			if err != nil {
+				return errors.Wrap(err, "can't find spotify cache directory")
+			}
+			opts.CacheDir = pth
+		}
+		opts.CacheStore = fscache.NewFSCacheStore(opts.CacheDir)
+	}
+	return nil
+}
+
+func (opts ClientOptions) authHTTPClient() *http.Client {
+	if opts.HTTPClient != nil {
+		return opts.HTTPClient
+	}
+	return &http.Client{Transport: opts.Transport, Timeout: opts.AuthTimeout}
+}
+
+func newHTTPClient(opts ClientOptions) *httpClient {
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Transport: opts.Transport, Timeout: opts.RequestTimeout}
+	}
+	return &httpClient{
+		client: client,
+		userAgent: opts.UserAgent,
+		limiter: opts.RateLimiter,
+		log: newLogger(opts.Logger, opts.LogSecrets),
+	}
+}
+
+// newSpotifyClient creates a client sharing an http client and a cache
+// with other clients.  If private is not nil, responses for user specific
+// resources are cached there instead of in shared.
+func newSpotifyClient(opts ClientOptions, hc *httpClient, shared, private *responseCache) (*SpotifyClient, error) {
+	baseURL, err := url.Parse(opts.BaseURL)
 	if err != nil {
-		return nil, errors.Wrap(err, "can't create spotify api client")
+		return nil, errors.Wrap(err, "can't parse base url " + opts.BaseURL)
+	}
+	log := newLogger(opts.Logger, opts.LogSecrets)
+	auth := opts.Auth
+	if auth == nil {
+		auth, err = newClientAuth(opts.ClientID, opts.ClientSecret, opts.AccountsURL, opts.authHTTPClient(), log)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create spotify auth")
+		}
 	}
 	client := &SpotifyClient{
-		client: api,
+		client: &apiClient{
+			baseURL: baseURL,
+			cacheTime: opts.CacheTime,
+			cachePolicies: opts.CachePolicies,
+			auth: auth,
+			cache: shared,
+			privateCache: private,
+			client: hc,
+			maxRetries: opts.MaxRetries,
+			maxRetryWait: opts.MaxRetryWait,
+			maxResponseSize: opts.MaxResponseSize,
+			observer: opts.Observer,
+			log: log,
+		},
 	}
 	return client, nil
 }
 
+type ExternalIDs struct {
+	ISRC string `json:"isrc,omitempty"`
+	EAN string `json:"ean,omitempty"`
+	UPC string `json:"upc,omitempty"`
+}
+
+type Copyright struct {
+	Text string `json:"text"`
+	// Type is C for copyright or P for sound recording copyright.
+	Type string `json:"type"`
+}
+
+// Restrictions explains why content isn't available, with a reason of
+// market, product or explicit.
+type Restrictions struct {
+	Reason string `json:"reason"`
+}
+
+type TrackLink struct {
+	Type string `json:"type"`
+	ID string `json:"id"`
+	URI string `json:"uri"`
+	Href string `json:"href"`
+	ExternalURLs map[string]string `json:"external_urls,omitempty"`
+}
+
 type FollowerInfo struct {
 	Total int `json:"total"`
 	Href *string `json:"href"`
@@ -51,20 +245,18 @@ type Image struct {
 }
 
 func (img *Image) Get(c *SpotifyClient) ([]byte, string, error) {
-	res, err := c.client.Client().Get(img.URL)
+	return img.GetContext(context.Background(), c)
+}
+
+func (img *Image) GetContext(ctx context.Context, c *SpotifyClient) ([]byte, string, error) {
+	res, err := c.client.execute(ctx, img.URL, func(ctx context.Context) (*http.Response, error) {
+		return c.client.Client().GetContext(ctx, img.URL)
+	})
 	if err != nil {
 		return nil, "", errors.Wrap(err, "can't get spotify image")
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return nil, "", errors.New(res.Status)
-	}
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, "", errors.Wrap(err, "can't read spotify image response")
-	}
-	ct := res.Header.Get("Content-Type")
-	return data, ct, nil
+	ct := res.header.Get("Content-Type")
+	return res.data, ct, nil
 }
 
 type SortableImages []*Image
@@ -0,0 +1,244 @@
+package spotifytest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rclancey/spotify"
+)
+
+// DefaultUserID is the user that approves authorization requests until
+// LogIn picks another.
+const DefaultUserID = "spotifytest-user"
+
+// grant is what an access or refresh token stands for.
+type grant struct {
+	userId string
+	scope string
+	// public grants came from a PKCE exchange, and are refreshed without
+	// the client secret.
+	public bool
+	expires time.Time
+}
+
+type authCode struct {
+	userId string
+	scope string
+	challenge string
+	redirectURI string
+}
+
+// AddUser adds a user who can log in and whose profile can be fetched.
+func (s *Server) AddUser(u *spotify.User) *spotify.User {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	u.Type = "user"
+	u.URI = "spotify:user:" + u.ID
+	u.Href = s.APIURL() + "users/" + u.ID
+	s.users[u.ID] = u
+	return u
+}
+
+// LogIn makes the user with the given id the one who approves requests
+// to the authorize page and codes from IssueCode.
+func (s *Server) LogIn(userId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loginUser = userId
+}
+
+// IssueCode creates an authorization code that the token endpoint will
+// exchange for a token with the given scopes, as if the logged in user had
+// approved the app.
+func (s *Server) IssueCode(scopes ...string) string {
+	return s.IssuePKCECode("", scopes...)
+}
+
+// IssuePKCECode is like IssueCode, but the exchange must include the
+// verifier for challenge instead of the client secret.
+func (s *Server) IssuePKCECode(challenge string, scopes ...string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.issueCode(challenge, "", scopes)
+}
+
+func (s *Server) issueCode(challenge, redirectURI string, scopes []string) string {
+	code := s.newID("code")
+	s.codes[code] = &authCode{
+		userId: s.loginUser,
+		scope: strings.Join(scopes, " "),
+		challenge: challenge,
+		redirectURI: redirectURI,
+	}
+	return code
+}
+
+// serveAuthorize approves every request on behalf of the logged in user
+// and redirects straight back with a code.
+func (s *Server) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	ru, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "INVALID_CLIENT: Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != ClientID {
+		http.Error(w, "INVALID_CLIENT: Invalid client", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" {
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	}
+	challenge := q.Get("code_challenge")
+	if challenge != "" && q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "code_challenge_method must be S256", http.StatusBadRequest)
+		return
+	}
+	rq := ru.Query()
+	rq.Set("code", s.issueCode(challenge, redirectURI, strings.Fields(q.Get("scope"))))
+	if state := q.Get("state"); state != "" {
+		rq.Set("state", state)
+	}
+	ru.RawQuery = rq.Encode()
+	http.Redirect(w, r, ru.String(), http.StatusFound)
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId = r.PostForm.Get("client_id")
+	}
+	if clientId != ClientID || (ok && clientSecret != ClientSecret) {
+		writeAuthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client")
+		return
+	}
+	res := map[string]interface{}{
+		"token_type": "Bearer",
+		"expires_in": 3600,
+	}
+	g := &grant{}
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		if !ok {
+			writeAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client secret")
+			return
+		}
+	case "authorization_code":
+		code, found := s.codes[r.PostForm.Get("code")]
+		if !found {
+			writeAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+			return
+		}
+		delete(s.codes, r.PostForm.Get("code"))
+		if code.redirectURI != "" && code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid redirect URI")
+			return
+		}
+		if code.challenge != "" {
+			verifier := r.PostForm.Get("code_verifier")
+			if verifier == "" || spotify.PKCEChallenge(verifier) != code.challenge {
+				writeAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier was incorrect")
+				return
+			}
+		} else if !ok {
+			writeAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client secret")
+			return
+		}
+		g.userId = code.userId
+		g.scope = code.scope
+		g.public = code.challenge != ""
+		rt := s.newID("refresh")
+		s.refreshTokens[rt] = g
+		res["refresh_token"] = rt
+		res["scope"] = g.scope
+	case "refresh_token":
+		rg, found := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !found {
+			writeAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+		if !ok && !rg.public {
+			writeAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client secret")
+			return
+		}
+		g.userId = rg.userId
+		g.scope = rg.scope
+		g.public = rg.public
+		res["scope"] = g.scope
+	default:
+		writeAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type parameter is missing")
+		return
+	}
+	token := s.newID("token")
+	g.expires = time.Now().Add(time.Hour)
+	s.tokens[token] = g
+	res["access_token"] = token
+	writeJSON(w, nil, res)
+}
+
+// serveMe returns the token's user, with private fields only if the token
+// has the scopes for them.
+func (s *Server) serveMe(w http.ResponseWriter, r *http.Request, g *grant) {
+	u, ok := s.users[g.userId]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "This request requires user authentication.")
+		return
+	}
+	js := userJSON(u)
+	scopes := strings.Fields(g.scope)
+	for _, scope := range scopes {
+		switch scope {
+		case spotify.ScopeUserReadPrivate:
+			js["country"] = u.Country
+			js["product"] = u.Product
+			explicit := u.ExplicitContent
+			if explicit == nil {
+				explicit = &spotify.ExplicitContent{}
+			}
+			js["explicit_content"] = explicit
+		case spotify.ScopeUserReadEmail:
+			js["email"] = u.Email
+		}
+	}
+	writeJSON(w, r, js)
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request, id string) {
+	u, ok := s.users[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such user")
+		return
+	}
+	writeJSON(w, r, userJSON(u))
+}
+
+// userJSON is a user's public profile.
+func userJSON(u *spotify.User) map[string]interface{} {
+	images := u.Images
+	if images == nil {
+		images = []*spotify.Image{}
+	}
+	followers := u.Followers
+	if followers == nil {
+		followers = &spotify.FollowerInfo{}
+	}
+	return map[string]interface{}{
+		"type": "user",
+		"id": u.ID,
+		"uri": u.URI,
+		"href": u.Href,
+		"display_name": u.DisplayName,
+		"images": images,
+		"followers": followers,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/user/" + u.ID},
+	}
+}
@@ -0,0 +1,118 @@
+package spotifytest
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/rclancey/cache"
+)
+
+// NullCacheStore never holds anything, so every request reaches the
+// server.
+type NullCacheStore struct{}
+
+func (NullCacheStore) Open(name string, cacheTime time.Duration) (cache.CacheFile, error) {
+	return nullCacheFile{}, nil
+}
+
+func (NullCacheStore) Delete(name string) error {
+	return nil
+}
+
+type nullCacheFile struct{}
+
+func (nullCacheFile) Read(p []byte) (int, error) { return 0, cache.CacheFileExpired }
+func (nullCacheFile) Write(p []byte) (int, error) { return len(p), nil }
+func (nullCacheFile) Close() error { return nil }
+func (nullCacheFile) Valid() bool { return false }
+
+// MemoryCacheStore keeps cache entries in memory, for tests that exercise
+// caching without touching the file system.  Like the file system store,
+// a zero cache time treats every entry as expired and a negative one
+// treats none as expired.
+type MemoryCacheStore struct {
+	mutex sync.Mutex
+	entries map[string]*memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	data []byte
+	written time.Time
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: map[string]*memoryCacheEntry{}}
+}
+
+func (s *MemoryCacheStore) Open(name string, cacheTime time.Duration) (cache.CacheFile, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f := &memoryCacheFile{store: s, name: name}
+	entry, ok := s.entries[name]
+	if ok && cacheTime != 0 && (cacheTime < 0 || time.Since(entry.written) < cacheTime) {
+		f.valid = true
+		f.rd = bytes.NewReader(entry.data)
+	}
+	return f, nil
+}
+
+func (s *MemoryCacheStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, name)
+	return nil
+}
+
+func (s *MemoryCacheStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
+
+// Age sets how long ago every entry was written, to expire entries without
+// waiting.
+func (s *MemoryCacheStore) Age(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range s.entries {
+		entry.written = time.Now().Add(-d)
+	}
+}
+
+type memoryCacheFile struct {
+	store *MemoryCacheStore
+	name string
+	valid bool
+	rd *bytes.Reader
+	buf *bytes.Buffer
+}
+
+func (f *memoryCacheFile) Read(p []byte) (int, error) {
+	if f.rd == nil {
+		return 0, cache.CacheFileExpired
+	}
+	return f.rd.Read(p)
+}
+
+func (f *memoryCacheFile) Write(p []byte) (int, error) {
+	if f.buf == nil {
+		f.buf = &bytes.Buffer{}
+	}
+	return f.buf.Write(p)
+}
+
+func (f *memoryCacheFile) Close() error {
+	if f.buf == nil {
+		return nil
+	}
+	f.store.mutex.Lock()
+	defer f.store.mutex.Unlock()
+	f.store.entries[f.name] = &memoryCacheEntry{data: f.buf.Bytes(), written: time.Now()}
+	f.buf = nil
+	return nil
+}
+
+func (f *memoryCacheFile) Valid() bool {
+	return f.valid
+}
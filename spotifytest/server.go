@@ -0,0 +1,919 @@
+// Package spotifytest provides an in-process fake of the spotify api and
+// accounts service for testing code built on the spotify package without
+// network access.
+package spotifytest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclancey/spotify"
+)
+
+const (
+	ClientID = "spotifytest-client"
+	ClientSecret = "spotifytest-secret"
+)
+
+// Failure makes the server fail requests whose path starts with Path (or
+// every request, if Path is empty) with Status.  Count limits how many
+// requests fail; 0 fails them until ClearFailures is called.  RetryAfter
+// is sent as the Retry-After header, in seconds, with 429s.
+type Failure struct {
+	Path string
+	Status int
+	RetryAfter int
+	Count int
+}
+
+// Server is a fake spotify backed by an in-memory dataset.  Seed it with
+// AddArtist, AddAlbum and AddTrack, and point a client at it with
+// ClientOptions.
+type Server struct {
+	*httptest.Server
+	mutex sync.Mutex
+	artists map[string]*spotify.Artist
+	albums map[string]*spotify.Album
+	tracks map[string]*spotify.Track
+	artistOrder []string
+	albumOrder []string
+	trackOrder []string
+	related map[string][]string
+	genres []string
+	features map[string]*spotify.AudioFeatures
+	analyses map[string]*spotify.AudioAnalysis
+	users map[string]*spotify.User
+	loginUser string
+	tokens map[string]*grant
+	refreshTokens map[string]*grant
+	codes map[string]*authCode
+	failures []*Failure
+	requests []string
+	nextID int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		artists: map[string]*spotify.Artist{},
+		albums: map[string]*spotify.Album{},
+		tracks: map[string]*spotify.Track{},
+		related: map[string][]string{},
+		features: map[string]*spotify.AudioFeatures{},
+		analyses: map[string]*spotify.AudioAnalysis{},
+		genres: []string{},
+		users: map[string]*spotify.User{},
+		tokens: map[string]*grant{},
+		refreshTokens: map[string]*grant{},
+		codes: map[string]*authCode{},
+	}
+	s.Server = httptest.NewServer(s)
+	s.AddUser(&spotify.User{ID: DefaultUserID, DisplayName: "Test User", Country: "US", Product: "premium"})
+	s.loginUser = DefaultUserID
+	return s
+}
+
+func (s *Server) APIURL() string {
+	return s.URL + "/v1/"
+}
+
+func (s *Server) AccountsURL() string {
+	return s.URL + "/"
+}
+
+// ClientOptions returns options for a client talking to the server, with
+// no rate limit and no caching.  Set CacheStore to a MemoryCacheStore to
+// exercise caching; responses carry ETags and honor If-None-Match.
+func (s *Server) ClientOptions() spotify.ClientOptions {
+	return spotify.ClientOptions{
+		ClientID: ClientID,
+		ClientSecret: ClientSecret,
+		BaseURL: s.APIURL(),
+		AccountsURL: s.AccountsURL(),
+		MaxRequestsPerSecond: -1,
+		CacheStore: NullCacheStore{},
+		Logger: spotify.NopLogger,
+	}
+}
+
+func (s *Server) NewClient() (*spotify.SpotifyClient, error) {
+	return spotify.NewSpotifyClientWithOptions(s.ClientOptions())
+}
+
+// ExpireTokens revokes every access token issued so far, so that api
+// requests using them get a 401.
+func (s *Server) ExpireTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = map[string]*grant{}
+}
+
+func (s *Server) Fail(f Failure) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ff := f
+	s.failures = append(s.failures, &ff)
+}
+
+func (s *Server) ClearFailures() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = nil
+}
+
+// Requests returns the method and request uri of every request served.
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) newID(kind string) string {
+	s.nextID += 1
+	return fmt.Sprintf("%s%06d", kind, s.nextID)
+}
+
+func (s *Server) AddArtist(art *spotify.Artist) *spotify.Artist {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addArtist(art)
+}
+
+func (s *Server) addArtist(art *spotify.Artist) *spotify.Artist {
+	if art.ID == "" {
+		art.ID = s.newID("artist")
+	}
+	if existing, ok := s.artists[art.ID]; ok {
+		return existing
+	}
+	art.Type = "artist"
+	art.URI = "spotify:artist:" + art.ID
+	art.Href = s.APIURL() + "artists/" + art.ID
+	s.artists[art.ID] = art
+	s.artistOrder = append(s.artistOrder, art.ID)
+	return art
+}
+
+// AddAlbum adds an album along with its artists and tracks.
+func (s *Server) AddAlbum(alb *spotify.Album) *spotify.Album {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addAlbum(alb)
+}
+
+func (s *Server) addAlbum(alb *spotify.Album) *spotify.Album {
+	if alb.ID == "" {
+		alb.ID = s.newID("album")
+	}
+	if existing, ok := s.albums[alb.ID]; ok {
+		return existing
+	}
+	alb.Type = "album"
+	alb.URI = "spotify:album:" + alb.ID
+	alb.Href = s.APIURL() + "albums/" + alb.ID
+	for i, art := range alb.Artists {
+		alb.Artists[i] = s.addArtist(art)
+	}
+	s.albums[alb.ID] = alb
+	s.albumOrder = append(s.albumOrder, alb.ID)
+	for i, tr := range alb.Tracks {
+		if tr.Album == nil {
+			tr.Album = alb
+		}
+		if len(tr.Artists) == 0 {
+			tr.Artists = alb.Artists
+		}
+		if tr.TrackNumber == 0 {
+			tr.TrackNumber = i + 1
+		}
+		if tr.DiscNumber == 0 {
+			tr.DiscNumber = 1
+		}
+		alb.Tracks[i] = s.addTrack(tr)
+	}
+	return alb
+}
+
+// AddTrack adds a track along with its album and artists.
+func (s *Server) AddTrack(tr *spotify.Track) *spotify.Track {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addTrack(tr)
+}
+
+func (s *Server) addTrack(tr *spotify.Track) *spotify.Track {
+	if tr.ID == "" {
+		tr.ID = s.newID("track")
+	}
+	if existing, ok := s.tracks[tr.ID]; ok {
+		return existing
+	}
+	tr.Type = "track"
+	tr.URI = "spotify:track:" + tr.ID
+	tr.Href = s.APIURL() + "tracks/" + tr.ID
+	for i, art := range tr.Artists {
+		tr.Artists[i] = s.addArtist(art)
+	}
+	s.tracks[tr.ID] = tr
+	s.trackOrder = append(s.trackOrder, tr.ID)
+	if tr.Album != nil {
+		alb := s.addAlbum(tr.Album)
+		tr.Album = alb
+		found := false
+		for _, x := range alb.Tracks {
+			if x.ID == tr.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			alb.Tracks = append(alb.Tracks, tr)
+		}
+	}
+	return tr
+}
+
+// SetRelated sets the artists returned as related to an artist.
+func (s *Server) SetRelated(artistId string, relatedIds ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.related[artistId] = relatedIds
+}
+
+// SetAudioFeatures sets the audio features of the track with af's ID.
+func (s *Server) SetAudioFeatures(af *spotify.AudioFeatures) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	af.Type = "audio_features"
+	af.URI = "spotify:track:" + af.ID
+	af.TrackHref = s.APIURL() + "tracks/" + af.ID
+	af.AnalysisURL = s.APIURL() + "audio-analysis/" + af.ID
+	s.features[af.ID] = af
+}
+
+// SetAudioAnalysis sets the audio analysis of a track.
+func (s *Server) SetAudioAnalysis(trackId string, aa *spotify.AudioAnalysis) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.analyses[trackId] = aa
+}
+
+func (s *Server) SetGenres(genres ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.genres = append([]string{}, genres...)
+}
+
+// failure returns the injected failure for a request, if any.  Callers
+// must hold the mutex.
+func (s *Server) failure(r *http.Request) *Failure {
+	for i, f := range s.failures {
+		if f.Path != "" && !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count -= 1
+			if f.Count == 0 {
+				s.failures = append(s.failures[:i:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, r.Method + " " + r.URL.RequestURI())
+	if f := s.failure(r); f != nil {
+		if f.Status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+		}
+		writeError(w, f.Status, http.StatusText(f.Status))
+		return
+	}
+	if r.URL.Path == "/api/token" {
+		s.serveToken(w, r)
+		return
+	}
+	if r.URL.Path == "/authorize" {
+		s.serveAuthorize(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		writeError(w, http.StatusNotFound, "Service not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	g, ok := s.tokens[token]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid access token")
+		return
+	}
+	if g.expires.Before(time.Now()) {
+		writeError(w, http.StatusUnauthorized, "The access token expired")
+		return
+	}
+	// split the escaped path, so that ids with slashes in them stay whole
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/v1/"), "/"), "/")
+	for i, part := range parts {
+		parts[i], _ = url.PathUnescape(part)
+	}
+	q := r.URL.Query()
+	switch {
+	case len(parts) == 1 && parts[0] == "me":
+		s.serveMe(w, r, g)
+	case len(parts) == 2 && parts[0] == "users":
+		s.serveUser(w, r, parts[1])
+	case len(parts) == 1 && (parts[0] == "tracks" || parts[0] == "albums" || parts[0] == "artists"):
+		s.serveSeveral(w, r, parts[0], q)
+	case len(parts) == 2 && (parts[0] == "tracks" || parts[0] == "albums" || parts[0] == "artists"):
+		s.serveOne(w, r, parts[0], parts[1])
+	case len(parts) == 1 && parts[0] == "audio-features":
+		s.serveSeveral(w, r, "audio_features", q)
+	case len(parts) == 2 && parts[0] == "audio-features":
+		s.serveOne(w, r, "audio_features", parts[1])
+	case len(parts) == 2 && parts[0] == "audio-analysis":
+		aa, ok := s.analyses[parts[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "analysis not found")
+			return
+		}
+		writeJSON(w, r, aa)
+	case len(parts) == 1 && parts[0] == "search":
+		s.serveSearch(w, r, q)
+	case len(parts) == 3 && parts[0] == "albums" && parts[2] == "tracks":
+		s.serveAlbumTracks(w, r, parts[1], q)
+	case len(parts) == 3 && parts[0] == "artists" && parts[2] == "albums":
+		s.serveArtistAlbums(w, r, parts[1], q)
+	case len(parts) == 3 && parts[0] == "artists" && parts[2] == "related-artists":
+		s.serveRelated(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "recommendations":
+		s.serveRecommendations(w, r, q)
+	case len(parts) == 2 && parts[0] == "recommendations" && parts[1] == "available-genre-seeds":
+		writeJSON(w, r, map[string]interface{}{"genres": s.genres})
+	default:
+		writeError(w, http.StatusNotFound, "Service not found")
+	}
+}
+
+func pageArgs(q url.Values) (int, int) {
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(q.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// page builds a paging object for items, with next and previous urls
+// pointing back at the path.
+func (s *Server) page(pth string, q url.Values, items []interface{}) map[string]interface{} {
+	limit, offset := pageArgs(q)
+	total := len(items)
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	start := offset
+	if start > total {
+		start = total
+	}
+	link := func(off int) string {
+		lq := url.Values{}
+		for k, v := range q {
+			lq[k] = v
+		}
+		lq.Set("offset", strconv.Itoa(off))
+		lq.Set("limit", strconv.Itoa(limit))
+		return s.URL + pth + "?" + lq.Encode()
+	}
+	var next, prev interface{}
+	if end < total {
+		next = link(end)
+	}
+	if offset > 0 {
+		p := offset - limit
+		if p < 0 {
+			p = 0
+		}
+		prev = link(p)
+	}
+	return map[string]interface{}{
+		"href": link(offset),
+		"items": items[start:end],
+		"limit": limit,
+		"offset": offset,
+		"total": total,
+		"next": next,
+		"previous": prev,
+	}
+}
+
+// searchTerms splits a query like `track:"x" artist:"y" z` into field
+// filters and free text.
+func searchTerms(query string) map[string]string {
+	terms := map[string]string{}
+	free := []string{}
+	for query != "" {
+		query = strings.TrimSpace(query)
+		i := strings.Index(query, ":\"")
+		sp := strings.IndexAny(query, " ")
+		if i > 0 && (sp < 0 || i < sp) {
+			field := query[:i]
+			rest := query[i + 2:]
+			j := strings.Index(rest, "\"")
+			if j < 0 {
+				j = len(rest)
+				terms[field] = rest
+				query = ""
+			} else {
+				terms[field] = rest[:j]
+				query = rest[j + 1:]
+			}
+			continue
+		}
+		if sp < 0 {
+			free = append(free, query)
+			query = ""
+		} else {
+			free = append(free, query[:sp])
+			query = query[sp + 1:]
+		}
+	}
+	if len(free) > 0 {
+		terms[""] = strings.Join(free, " ")
+	}
+	return terms
+}
+
+func matches(name, term string) bool {
+	return strings.Contains(strings.ToLower(name), strings.ToLower(term))
+}
+
+func anyArtistMatches(artists []*spotify.Artist, term string) bool {
+	for _, art := range artists {
+		if matches(art.Name, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, q url.Values) {
+	terms := searchTerms(q.Get("q"))
+	if len(terms) == 0 {
+		writeError(w, http.StatusBadRequest, "No search query")
+		return
+	}
+	res := map[string]interface{}{}
+	for _, kind := range strings.Split(q.Get("type"), ",") {
+		items := []interface{}{}
+		switch kind {
+		case "artist":
+			for _, id := range s.artistOrder {
+				art := s.artists[id]
+				if t, ok := terms[""]; ok && !matches(art.Name, t) {
+					continue
+				}
+				if t, ok := terms["artist"]; ok && !matches(art.Name, t) {
+					continue
+				}
+				items = append(items, artistJSON(art))
+			}
+			res["artists"] = s.page(r.URL.Path, q, items)
+		case "album":
+			for _, id := range s.albumOrder {
+				alb := s.albums[id]
+				if t, ok := terms[""]; ok && !matches(alb.Name, t) {
+					continue
+				}
+				if t, ok := terms["album"]; ok && !matches(alb.Name, t) {
+					continue
+				}
+				if t, ok := terms["artist"]; ok && !anyArtistMatches(alb.Artists, t) {
+					continue
+				}
+				items = append(items, simpleAlbumJSON(alb))
+			}
+			res["albums"] = s.page(r.URL.Path, q, items)
+		case "track":
+			for _, id := range s.trackOrder {
+				tr := s.tracks[id]
+				if t, ok := terms[""]; ok && !matches(tr.Name, t) {
+					continue
+				}
+				if t, ok := terms["track"]; ok && !matches(tr.Name, t) {
+					continue
+				}
+				if t, ok := terms["album"]; ok && (tr.Album == nil || !matches(tr.Album.Name, t)) {
+					continue
+				}
+				if t, ok := terms["artist"]; ok && !anyArtistMatches(tr.Artists, t) {
+					continue
+				}
+				items = append(items, trackJSON(tr))
+			}
+			res["tracks"] = s.page(r.URL.Path, q, items)
+		default:
+			writeError(w, http.StatusBadRequest, "Bad search type field " + kind)
+			return
+		}
+	}
+	writeJSON(w, r, res)
+}
+
+func (s *Server) serveAlbumTracks(w http.ResponseWriter, r *http.Request, id string, q url.Values) {
+	alb, ok := s.albums[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id: 'spotify:album:" + id + "'")
+		return
+	}
+	writeJSON(w, r, s.page(r.URL.Path, q, albumTrackItems(alb)))
+}
+
+// maxIDs is how many ids each of the "several" endpoints accepts.
+var maxIDs = map[string]int{
+	"tracks": 50,
+	"albums": 20,
+	"artists": 50,
+	"audio_features": 100,
+}
+
+func (s *Server) serveSeveral(w http.ResponseWriter, r *http.Request, kind string, q url.Values) {
+	ids := strings.Split(q.Get("ids"), ",")
+	if q.Get("ids") == "" {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	if len(ids) > maxIDs[kind] {
+		writeError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+	items := make([]interface{}, len(ids))
+	for i, id := range ids {
+		if obj := s.object(kind, id); obj != nil {
+			items[i] = obj
+		}
+	}
+	writeJSON(w, r, map[string]interface{}{kind: items})
+}
+
+func (s *Server) serveOne(w http.ResponseWriter, r *http.Request, kind, id string) {
+	obj := s.object(kind, id)
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "Non existing id: 'spotify:" + strings.TrimSuffix(kind, "s") + ":" + id + "'")
+		return
+	}
+	writeJSON(w, r, obj)
+}
+
+// object returns the full json object for an id, or nil if there's no
+// such object.
+func (s *Server) object(kind, id string) map[string]interface{} {
+	switch kind {
+	case "tracks":
+		if tr, ok := s.tracks[id]; ok {
+			return trackJSON(tr)
+		}
+	case "albums":
+		if alb, ok := s.albums[id]; ok {
+			return s.albumJSON(alb)
+		}
+	case "artists":
+		if art, ok := s.artists[id]; ok {
+			return artistJSON(art)
+		}
+	case "audio_features":
+		if af, ok := s.features[id]; ok {
+			return featuresJSON(af)
+		}
+	}
+	return nil
+}
+
+// albumTrackItems returns an album's tracks in disc and track order.
+func albumTrackItems(alb *spotify.Album) []interface{} {
+	tracks := append([]*spotify.Track{}, alb.Tracks...)
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if tracks[i].DiscNumber != tracks[j].DiscNumber {
+			return tracks[i].DiscNumber < tracks[j].DiscNumber
+		}
+		return tracks[i].TrackNumber < tracks[j].TrackNumber
+	})
+	items := make([]interface{}, len(tracks))
+	for i, tr := range tracks {
+		items[i] = simpleTrackJSON(tr)
+	}
+	return items
+}
+
+func (s *Server) serveArtistAlbums(w http.ResponseWriter, r *http.Request, id string, q url.Values) {
+	art, ok := s.artists[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id: 'spotify:artist:" + id + "'")
+		return
+	}
+	items := []interface{}{}
+	for _, albId := range s.albumOrder {
+		alb := s.albums[albId]
+		for _, x := range alb.Artists {
+			if x.ID == art.ID {
+				items = append(items, simpleAlbumJSON(alb))
+				break
+			}
+		}
+	}
+	writeJSON(w, r, s.page(r.URL.Path, q, items))
+}
+
+func (s *Server) serveRelated(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := s.artists[id]; !ok {
+		writeError(w, http.StatusNotFound, "Non existing id: 'spotify:artist:" + id + "'")
+		return
+	}
+	items := []interface{}{}
+	for _, relId := range s.related[id] {
+		if art, ok := s.artists[relId]; ok {
+			items = append(items, artistJSON(art))
+		}
+	}
+	writeJSON(w, r, map[string]interface{}{"artists": items})
+}
+
+// serveRecommendations returns tracks by the seed artists and the seed
+// tracks' artists first, followed by any other tracks.
+func (s *Server) serveRecommendations(w http.ResponseWriter, r *http.Request, q url.Values) {
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	seeds := []interface{}{}
+	seedArtists := map[string]bool{}
+	n := 0
+	for _, kind := range []string{"artist", "track", "genre"} {
+		v := q.Get("seed_" + kind + "s")
+		if v == "" {
+			continue
+		}
+		for _, id := range strings.Split(v, ",") {
+			n += 1
+			switch kind {
+			case "artist":
+				if _, ok := s.artists[id]; !ok {
+					writeError(w, http.StatusBadRequest, "Invalid artist id")
+					return
+				}
+				seedArtists[id] = true
+			case "track":
+				tr, ok := s.tracks[id]
+				if !ok {
+					writeError(w, http.StatusBadRequest, "Invalid track id")
+					return
+				}
+				for _, art := range tr.Artists {
+					seedArtists[art.ID] = true
+				}
+			}
+			seeds = append(seeds, map[string]interface{}{
+				"type": strings.ToUpper(kind),
+				"id": id,
+				"initialPoolSize": len(s.tracks),
+				"afterFilteringSize": len(s.tracks),
+				"afterRelinkingSize": len(s.tracks),
+			})
+		}
+	}
+	if n == 0 || n > 5 {
+		writeError(w, http.StatusBadRequest, "Number of seeds must be between 1 and 5")
+		return
+	}
+	first := []interface{}{}
+	rest := []interface{}{}
+	for _, id := range s.trackOrder {
+		tr := s.tracks[id]
+		seeded := false
+		for _, art := range tr.Artists {
+			if seedArtists[art.ID] {
+				seeded = true
+				break
+			}
+		}
+		if seeded {
+			first = append(first, trackJSON(tr))
+		} else {
+			rest = append(rest, trackJSON(tr))
+		}
+	}
+	tracks := append(first, rest...)
+	if len(tracks) > limit {
+		tracks = tracks[:limit]
+	}
+	writeJSON(w, r, map[string]interface{}{"tracks": tracks, "seeds": seeds})
+}
+
+func artistJSON(art *spotify.Artist) map[string]interface{} {
+	genres := art.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+	images := art.Images
+	if images == nil {
+		images = []*spotify.Image{}
+	}
+	followers := art.Followers
+	if followers == nil {
+		followers = &spotify.FollowerInfo{}
+	}
+	return map[string]interface{}{
+		"type": "artist",
+		"id": art.ID,
+		"uri": art.URI,
+		"href": art.Href,
+		"name": art.Name,
+		"genres": genres,
+		"images": images,
+		"popularity": art.Popularity,
+		"followers": followers,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/artist/" + art.ID},
+	}
+}
+
+func simpleArtistJSON(art *spotify.Artist) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "artist",
+		"id": art.ID,
+		"uri": art.URI,
+		"href": art.Href,
+		"name": art.Name,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/artist/" + art.ID},
+	}
+}
+
+func simpleArtistsJSON(artists []*spotify.Artist) []interface{} {
+	items := make([]interface{}, len(artists))
+	for i, art := range artists {
+		items[i] = simpleArtistJSON(art)
+	}
+	return items
+}
+
+func simpleAlbumJSON(alb *spotify.Album) map[string]interface{} {
+	images := alb.Images
+	if images == nil {
+		images = []*spotify.Image{}
+	}
+	albumType := alb.AlbumType
+	if albumType == "" {
+		albumType = "album"
+	}
+	return map[string]interface{}{
+		"type": "album",
+		"album_type": albumType,
+		"id": alb.ID,
+		"uri": alb.URI,
+		"href": alb.Href,
+		"name": alb.Name,
+		"artists": simpleArtistsJSON(alb.Artists),
+		"images": images,
+		"release_date": alb.ReleaseDate,
+		"release_date_precision": alb.ReleaseDatePrecision,
+		"total_tracks": len(alb.Tracks),
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/album/" + alb.ID},
+	}
+}
+
+// albumJSON is a full album, with the first page of its tracks embedded.
+func (s *Server) albumJSON(alb *spotify.Album) map[string]interface{} {
+	js := simpleAlbumJSON(alb)
+	genres := alb.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+	js["genres"] = genres
+	js["popularity"] = alb.Popularity
+	js["label"] = alb.Label
+	copyrights := alb.Copyrights
+	if copyrights == nil {
+		copyrights = []*spotify.Copyright{}
+	}
+	js["copyrights"] = copyrights
+	if alb.ExternalIDs != nil {
+		js["external_ids"] = alb.ExternalIDs
+	}
+	q := url.Values{}
+	q.Set("limit", "50")
+	js["tracks"] = s.page("/v1/albums/" + alb.ID + "/tracks", q, albumTrackItems(alb))
+	return js
+}
+
+func simpleTrackJSON(tr *spotify.Track) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "track",
+		"id": tr.ID,
+		"uri": tr.URI,
+		"href": tr.Href,
+		"name": tr.Name,
+		"artists": simpleArtistsJSON(tr.Artists),
+		"track_number": tr.TrackNumber,
+		"disc_number": tr.DiscNumber,
+		"duration_ms": tr.DurationMS,
+		"explicit": tr.Explicit,
+		"preview_url": nilIfEmpty(tr.PreviewURL),
+		"is_local": tr.IsLocal,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/track/" + tr.ID},
+	}
+}
+
+func trackJSON(tr *spotify.Track) map[string]interface{} {
+	js := simpleTrackJSON(tr)
+	js["popularity"] = tr.Popularity
+	if tr.ExternalIDs != nil {
+		js["external_ids"] = tr.ExternalIDs
+	}
+	if tr.Album != nil {
+		js["album"] = simpleAlbumJSON(tr.Album)
+	}
+	return js
+}
+
+func featuresJSON(af *spotify.AudioFeatures) map[string]interface{} {
+	data, _ := json.Marshal(af)
+	js := map[string]interface{}{}
+	json.Unmarshal(data, &js)
+	return js
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// writeJSON writes obj with an ETag, or a 304 if it matches r's
+// If-None-Match.  Responses without a request get no ETag.
+func writeJSON(w http.ResponseWriter, r *http.Request, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r != nil {
+		sum := sha1.Sum(data)
+		etag := "\"" + hex.EncodeToString(sum[:]) + "\""
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"status": status,
+			"message": msg,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeAuthError(w http.ResponseWriter, status int, code, desc string) {
+	data, _ := json.Marshal(map[string]string{
+		"error": code,
+		"error_description": desc,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
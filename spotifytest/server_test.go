@@ -0,0 +1,224 @@
+package spotifytest_test
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func newClient(t *testing.T, s *spotifytest.Server) *spotify.SpotifyClient {
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func names(tracks []*spotify.Track) []string {
+	n := make([]string, len(tracks))
+	for i, tr := range tracks {
+		n[i] = tr.Name
+	}
+	return n
+}
+
+// status returns the status of the api error in err, or 0 if there isn't
+// one.
+func status(err error) int {
+	var apiErr *spotify.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
+func TestSearch(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	horses := &spotify.Artist{Name: "Band of Horses"}
+	shins := &spotify.Artist{Name: "The Shins"}
+	s.AddAlbum(&spotify.Album{Name: "Infinite Arms", Artists: []*spotify.Artist{horses}, Tracks: []*spotify.Track{
+		{Name: "Factory"},
+		{Name: "Laredo"},
+	}})
+	s.AddAlbum(&spotify.Album{Name: "Wincing the Night Away", Artists: []*spotify.Artist{shins}, Tracks: []*spotify.Track{
+		{Name: "Australia"},
+		{Name: "Phantom Limb"},
+	}})
+	c := newClient(t, s)
+	tracks, err := c.SearchTrack("", "horses", "laredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(tracks); len(got) != 1 || got[0] != "Laredo" {
+		t.Errorf("track search got %v, want Laredo", got)
+	}
+	tracks, err = c.SearchTrack("wincing", "", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(tracks); len(got) != 2 {
+		t.Errorf("track search by album got %v, want both Shins tracks", got)
+	}
+	albums, err := c.SearchAlbum("shins", "night")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 1 || albums[0].Name != "Wincing the Night Away" {
+		t.Errorf("album search got %v", albums)
+	}
+	artists, err := c.SearchArtist("band of")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artists) != 1 || artists[0].Name != "Band of Horses" {
+		t.Errorf("free text artist search got %v", artists)
+	}
+	_, err = c.Search("x", "playlist")
+	if status(err) != 400 {
+		t.Errorf("search for an unknown type got %v, want a 400", err)
+	}
+}
+
+func TestPagingLinks(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	alb := &spotify.Album{Name: "Album"}
+	for i := 0; i < 5; i += 1 {
+		alb.Tracks = append(alb.Tracks, &spotify.Track{Name: fmt.Sprintf("Track %d", i + 1)})
+	}
+	s.AddAlbum(alb)
+	c := newClient(t, s)
+	q := url.Values{}
+	q.Set("limit", "2")
+	sr, err := c.GetPaged("albums/" + alb.ID + "/tracks", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := names(sr.Tracks)
+	if strings.Join(got, ",") != "Track 1,Track 2,Track 3,Track 4,Track 5" {
+		t.Errorf("paged through tracks %v", got)
+	}
+	offsets := []string{}
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "GET /v1/albums/") {
+			u, _ := url.Parse(strings.TrimPrefix(req, "GET "))
+			offsets = append(offsets, u.Query().Get("offset") + "/" + u.Query().Get("limit"))
+		}
+	}
+	if strings.Join(offsets, " ") != "/2 2/2 4/2" {
+		t.Errorf("requested offsets/limits %v, want the next links' 2/2 and 4/2", offsets)
+	}
+}
+
+func TestArtistAlbumsAndRelated(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	art := s.AddArtist(&spotify.Artist{Name: "Prolific"})
+	for i := 0; i < 60; i += 1 {
+		s.AddAlbum(&spotify.Album{Name: fmt.Sprintf("Album %d", i), Artists: []*spotify.Artist{art}})
+	}
+	friend := s.AddArtist(&spotify.Artist{Name: "Friend"})
+	s.SetRelated(art.ID, friend.ID, "unknown")
+	c := newClient(t, s)
+	art, err := c.GetArtist(art.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums, err := art.GetAlbums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 60 {
+		t.Errorf("got %d albums, want all 60 across two pages", len(albums))
+	}
+	related, err := art.GetRelated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 || related[0].ID != friend.ID {
+		t.Errorf("got related artists %v, want just %s", related, friend.ID)
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	s.AddTrack(&spotify.Track{Name: "Other", Artists: []*spotify.Artist{{Name: "Someone"}}})
+	seed := s.AddArtist(&spotify.Artist{Name: "Seed"})
+	s.AddTrack(&spotify.Track{Name: "Seeded", Artists: []*spotify.Artist{seed}})
+	s.SetGenres("folk", "indie")
+	c := newClient(t, s)
+	res, err := c.Recommend(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(res.Tracks); len(got) != 2 || got[0] != "Seeded" {
+		t.Errorf("recommended %v, want the seed artist's track first", got)
+	}
+	if len(res.Seeds) != 1 || res.Seeds[0].ID != seed.ID {
+		t.Errorf("got seeds %+v", res.Seeds)
+	}
+	_, err = c.Recommend(&spotify.Artist{ID: "unknown"})
+	if status(err) != 400 {
+		t.Errorf("recommending from an unknown artist got %v, want a 400", err)
+	}
+	genres, err := c.RecommendationGenres()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(genres, ",") != "folk,indie" {
+		t.Errorf("got genre seeds %v", genres)
+	}
+	res, err = c.Mix("folk", spotify.MixArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Tracks) != 2 {
+		t.Errorf("mix got %v", names(res.Tracks))
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	tr := s.AddTrack(&spotify.Track{Name: "Flaky"})
+	var retries []int
+	opts := s.ClientOptions()
+	opts.Observer = spotify.ObserverFunc(func(info *spotify.RequestInfo) {
+		retries = append(retries, info.Retries)
+	})
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Fail(spotifytest.Failure{Path: "/v1/tracks", Status: 503, Count: 1})
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Fatalf("request failed after one 503: %s", err)
+	}
+	if len(retries) != 1 || retries[0] != 1 {
+		t.Errorf("got retries %v, want one", retries)
+	}
+	opts.MaxRetries = -1
+	c, err = spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Fail(spotifytest.Failure{Path: "/v1/tracks", Status: 500})
+	_, err = c.GetTrack(tr.ID)
+	if status(err) != 500 {
+		t.Errorf("got error %v, want a 500", err)
+	}
+	s.ClearFailures()
+	_, err = c.GetTrack(tr.ID)
+	if err != nil {
+		t.Errorf("request failed after clearing failures: %s", err)
+	}
+}
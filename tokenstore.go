@@ -0,0 +1,160 @@
+package spotify
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TokenStore persists user tokens across process restarts.  Load returns
+// a nil token and a nil error if nothing has been stored yet.
+type TokenStore interface {
+	Load() (*Token, error)
+	Save(tok *Token) error
+}
+
+type MemoryTokenStore struct {
+	mutex sync.Mutex
+	token *Token
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+func (s *MemoryTokenStore) Load() (*Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == nil {
+		return nil, nil
+	}
+	tok := *s.token
+	return &tok, nil
+}
+
+func (s *MemoryTokenStore) Save(tok *Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if tok == nil {
+		s.token = nil
+		return nil
+	}
+	clone := *tok
+	s.token = &clone
+	return nil
+}
+
+// FileTokenStore keeps a token as json in a file readable only by the
+// owner.  If created with a key, the file contents are encrypted with
+// AES-GCM.
+type FileTokenStore struct {
+	mutex sync.Mutex
+	path string
+	aead cipher.AEAD
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+// NewEncryptedFileTokenStore creates a file store that encrypts the token
+// at rest.  The key must be 16, 24 or 32 bytes long.
+func NewEncryptedFileTokenStore(path string, key []byte) (*FileTokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create token store cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create token store cipher")
+	}
+	return &FileTokenStore{path: path, aead: aead}, nil
+}
+
+func (s *FileTokenStore) Load() (*Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "can't read token file " + s.path)
+	}
+	if s.aead != nil {
+		n := s.aead.NonceSize()
+		if len(data) < n {
+			return nil, errors.New("token file " + s.path + " is truncated")
+		}
+		data, err = s.aead.Open(nil, data[:n], data[n:], nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't decrypt token file " + s.path)
+		}
+	}
+	tok := &Token{}
+	err = json.Unmarshal(data, tok)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't unmarshal token file " + s.path)
+	}
+	return tok, nil
+}
+
+func (s *FileTokenStore) Save(tok *Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if tok == nil {
+		err := os.Remove(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "can't remove token file " + s.path)
+		}
+		return nil
+	}
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal token")
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		_, err = io.ReadFull(rand.Reader, nonce)
+		if err != nil {
+			return errors.Wrap(err, "can't generate token file nonce")
+		}
+		data = s.aead.Seal(nonce, nonce, data, nil)
+	}
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return errors.Wrap(err, "can't create token directory " + dir)
+	}
+	f, err := ioutil.TempFile(dir, "." + filepath.Base(s.path) + ".")
+	if err != nil {
+		return errors.Wrap(err, "can't create token file")
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "can't write token file")
+	}
+	err = os.Rename(f.Name(), s.path)
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "can't write token file " + s.path)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package spotify_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "spotify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypted, err := spotify.NewEncryptedFileTokenStore(filepath.Join(dir, "encrypted", "token"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]*spotify.FileTokenStore{
+		"plain": spotify.NewFileTokenStore(filepath.Join(dir, "plain", "token")),
+		"encrypted": encrypted,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			tok, err := store.Load()
+			if err != nil || tok != nil {
+				t.Fatalf("missing file loaded %+v, %v; want nothing", tok, err)
+			}
+			want := &spotify.Token{
+				AccessToken: "access",
+				TokenType: "Bearer",
+				RefreshToken: "refresh",
+				Scope: spotify.ScopeUserReadPrivate,
+				Expires: time.Now().Add(time.Hour).Round(time.Second),
+			}
+			err = store.Save(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err = store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != want.AccessToken || tok.RefreshToken != want.RefreshToken || tok.Scope != want.Scope || !tok.Expires.Equal(want.Expires) {
+				t.Errorf("loaded %+v, want %+v", tok, want)
+			}
+			err = store.Save(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err = store.Load()
+			if err != nil || tok != nil {
+				t.Errorf("loaded %+v, %v after saving nil; want nothing", tok, err)
+			}
+			err = store.Save(nil)
+			if err != nil {
+				t.Errorf("saving nil twice: %s", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedFileTokenStoreWrongKey(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	fn := filepath.Join(dir, "token")
+	store, err := spotify.NewEncryptedFileTokenStore(fn, []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(&spotify.Token{AccessToken: "secret-access-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || bytes.Contains(data, []byte("secret-access-token")) {
+		t.Errorf("token file isn't encrypted: %q", data)
+	}
+	other, err := spotify.NewEncryptedFileTokenStore(fn, []byte("fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := other.Load()
+	if err == nil {
+		t.Errorf("loaded %+v with the wrong key", tok)
+	}
+	_, err = spotify.NewEncryptedFileTokenStore(fn, []byte("short"))
+	if err == nil {
+		t.Error("created a store with a 5 byte key")
+	}
+}
+
+type failingTokenStore struct{}
+
+func (failingTokenStore) Load() (*spotify.Token, error) {
+	return nil, nil
+}
+
+func (failingTokenStore) Save(tok *spotify.Token) error {
+	return errors.New("disk full")
+}
+
+func TestTokenSaveFailureKeepsToken(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback")
+	auth.SetAccountsURL(s.AccountsURL())
+	auth.SetLogger(spotify.NopLogger, false)
+	err := auth.UseTokenStore(failingTokenStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := auth.Exchange(s.IssueCode())
+	if err != nil {
+		t.Fatalf("exchange failed because the token couldn't be saved: %s", err)
+	}
+	err = auth.Refresh()
+	if err != nil {
+		t.Fatalf("refresh failed because the token couldn't be saved: %s", err)
+	}
+	if !auth.Token().Valid() || auth.Token().AccessToken == tok.AccessToken {
+		t.Errorf("got token %+v, want a new valid one", auth.Token())
+	}
+}
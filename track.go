@@ -1,18 +1,23 @@
 package spotify
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"path"
 
 	"github.com/pkg/errors"
 )
 
+const maxTracksPerRequest = 50
+
 type Track struct {
 	Type string `json:"type"`
 	ID string `json:"id"`
 	URI string `json:"uri"`
 	Name string `json:"name"`
-	Album *Album `json:"album"`
-	Artists []*Artist `json:"artist"`
+	Album *Album `json:"album,omitempty"`
+	Artists []*Artist `json:"artists"`
 	TrackNumber int `json:"track_number"`
 	DiscNumber int `json:"disc_number"`
 	DurationMS int `json:"duration_ms"`
@@ -20,10 +25,25 @@ type Track struct {
 	Explicit bool `json:"explicit"`
 	Href string `json:"href"`
 	PreviewURL string `json:"preview_url"`
+	ExternalIDs *ExternalIDs `json:"external_ids,omitempty"`
+	ExternalURLs map[string]string `json:"external_urls,omitempty"`
+	AvailableMarkets []string `json:"available_markets,omitempty"`
+	// LinkedFrom, Restrictions and IsPlayable are only set when a market
+	// was given with WithMarket.  LinkedFrom is the track that was asked
+	// for, when spotify relinked it to this one because it isn't playable
+	// in that market.
+	LinkedFrom *TrackLink `json:"linked_from,omitempty"`
+	Restrictions *Restrictions `json:"restrictions,omitempty"`
+	IsPlayable *bool `json:"is_playable,omitempty"`
+	IsLocal bool `json:"is_local"`
 	c *SpotifyClient
 }
 
 func (c *SpotifyClient) SearchTrack(album, artist, name string) ([]*Track, error) {
+	return c.SearchTrackContext(context.Background(), album, artist, name)
+}
+
+func (c *SpotifyClient) SearchTrackContext(ctx context.Context, album, artist, name string) ([]*Track, error) {
 	query := fmt.Sprintf("track:\"%s\"", name)
 	if album != "" {
 		query += fmt.Sprintf(" album:\"%s\"", album)
@@ -31,16 +51,61 @@ func (c *SpotifyClient) SearchTrack(album, artist, name string) ([]*Track, error
 	if artist != "" {
 		query += fmt.Sprintf(" artist:\"%s\"", artist)
 	}
-	res, err := c.Search(query, "track")
+	res, err := c.SearchContext(ctx, query, "track")
 	if err != nil {
 		return nil, errors.Wrap(err, "can't search spotify for track " + name)
 	}
 	return res.Tracks, nil
 }
 
+// GetTrack gets a track by its spotify id.
+func (c *SpotifyClient) GetTrack(id string) (*Track, error) {
+	return c.GetTrackContext(context.Background(), id)
+}
+
+func (c *SpotifyClient) GetTrackContext(ctx context.Context, id string) (*Track, error) {
+	if id == "" {
+		return nil, errors.New("no track id")
+	}
+	tr := &Track{}
+	err := c.client.getJSON(ctx, path.Join("tracks", id), marketArgs(ctx), tr)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify track " + id)
+	}
+	c.addClientToTracks(tr)
+	return tr, nil
+}
+
+// GetTracks gets tracks by their spotify ids, in the same order.
+func (c *SpotifyClient) GetTracks(ids ...string) ([]*Track, error) {
+	return c.GetTracksContext(context.Background(), ids...)
+}
+
+func (c *SpotifyClient) GetTracksContext(ctx context.Context, ids ...string) ([]*Track, error) {
+	found, err := c.client.getSeveral(ctx, "tracks", "tracks", ids, maxTracksPerRequest, marketArgs(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify tracks")
+	}
+	trs := make([]*Track, len(ids))
+	for i, id := range ids {
+		data, ok := found[id]
+		if !ok {
+			continue
+		}
+		tr := &Track{}
+		err = json.Unmarshal(data, tr)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal spotify track " + id)
+		}
+		trs[i] = tr
+	}
+	c.addClientToTracks(trs...)
+	return trs, nil
+}
+
 func (c *SpotifyClient) addClientToTracks(tracks ...*Track) {
 	for _, tr := range tracks {
-		if tr.c == nil {
+		if tr != nil && tr.c == nil {
 			tr.c = c
 			if tr.Album != nil {
 				c.addClientToAlbums(tr.Album)
@@ -0,0 +1,131 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+type ExplicitContent struct {
+	FilterEnabled bool `json:"filter_enabled"`
+	FilterLocked bool `json:"filter_locked"`
+}
+
+type User struct {
+	Type string `json:"type"`
+	ID string `json:"id"`
+	URI string `json:"uri"`
+	DisplayName string `json:"display_name"`
+	Country string `json:"country,omitempty"`
+	Email string `json:"email,omitempty"`
+	Product string `json:"product,omitempty"`
+	ExplicitContent *ExplicitContent `json:"explicit_content,omitempty"`
+	ExternalURLs map[string]string `json:"external_urls"`
+	Followers *FollowerInfo `json:"followers"`
+	Href string `json:"href"`
+	Images []*Image `json:"images"`
+	c *SpotifyClient
+}
+
+func (u *User) IsPremium() bool {
+	return u.Product == "premium"
+}
+
+// CurrentUser gets the profile of the user the client is authenticated
+// as.  Country, product and explicit content settings are only filled in
+// if the token has the user-read-private scope, and email only with
+// user-read-email.
+func (c *SpotifyClient) CurrentUser() (*User, error) {
+	return c.CurrentUserContext(context.Background())
+}
+
+func (c *SpotifyClient) CurrentUserContext(ctx context.Context) (*User, error) {
+	user := &User{}
+	err := c.client.getJSON(ctx, "me", url.Values{}, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get current spotify user")
+	}
+	user.c = c
+	c.mutex.Lock()
+	c.me = user
+	c.mutex.Unlock()
+	return user, nil
+}
+
+// currentUser returns the profile the client last fetched, fetching it if
+// there isn't one yet or the context asks for a fresh one.
+func (c *SpotifyClient) currentUser(ctx context.Context) (*User, error) {
+	c.mutex.Lock()
+	user := c.me
+	c.mutex.Unlock()
+	if user != nil && cacheModeFrom(ctx) == CacheModeDefault {
+		return user, nil
+	}
+	return c.CurrentUserContext(ctx)
+}
+
+// GetUser gets the public profile of any user.
+func (c *SpotifyClient) GetUser(id string) (*User, error) {
+	return c.GetUserContext(context.Background(), id)
+}
+
+func (c *SpotifyClient) GetUserContext(ctx context.Context, id string) (*User, error) {
+	user := &User{}
+	err := c.client.getJSON(ctx, "users/" + url.PathEscape(id), url.Values{}, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify user " + id)
+	}
+	user.c = c
+	return user, nil
+}
+
+// UserID returns the current user's id.  UserID, Market and IsPremium
+// share the profile the client fetched last, so only the first of them
+// makes a request; pass a context from WithCacheMode with
+// CacheModeRefresh to fetch it again.
+func (c *SpotifyClient) UserID() (string, error) {
+	return c.UserIDContext(context.Background())
+}
+
+func (c *SpotifyClient) UserIDContext(ctx context.Context) (string, error) {
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// Market returns the current user's country, for passing as the market
+// to endpoints that take one.
+func (c *SpotifyClient) Market() (string, error) {
+	return c.MarketContext(context.Background())
+}
+
+func (c *SpotifyClient) MarketContext(ctx context.Context) (string, error) {
+	err := c.requireScopes(methodMarket)
+	if err != nil {
+		return "", err
+	}
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	return user.Country, nil
+}
+
+func (c *SpotifyClient) IsPremium() (bool, error) {
+	return c.IsPremiumContext(context.Background())
+}
+
+func (c *SpotifyClient) IsPremiumContext(ctx context.Context) (bool, error) {
+	err := c.requireScopes(methodIsPremium)
+	if err != nil {
+		return false, err
+	}
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	return user.IsPremium(), nil
+}
@@ -0,0 +1,152 @@
+package spotify_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rclancey/spotify"
+	"github.com/rclancey/spotify/spotifytest"
+)
+
+// userClient logs the server's current user in with the given scopes and
+// returns a client using their token.
+func userClient(t *testing.T, s *spotifytest.Server, opts spotify.ClientOptions, scopes ...string) *spotify.SpotifyClient {
+	auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, "http://127.0.0.1/callback")
+	auth.SetAccountsURL(s.AccountsURL())
+	auth.SetLogger(spotify.NopLogger, false)
+	_, err := auth.Exchange(s.IssueCode(scopes...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Auth = auth
+	c, err := spotify.NewSpotifyClientWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestScopeMissing(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	c := userClient(t, s, s.ClientOptions())
+	_, err := c.Market()
+	if !errors.Is(err, spotify.ErrScopeMissing) {
+		t.Fatalf("got error %v, want ErrScopeMissing", err)
+	}
+	var sme *spotify.ScopeMissingError
+	if !errors.As(err, &sme) || sme.Method != "Market" || len(sme.Missing) != 1 || sme.Missing[0] != spotify.ScopeUserReadPrivate {
+		t.Errorf("got %#v, want Market missing %s", err, spotify.ScopeUserReadPrivate)
+	}
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "GET /v1/") {
+			t.Errorf("made request %s despite the missing scope", req)
+		}
+	}
+	c = userClient(t, s, s.ClientOptions(), spotify.ScopeUserReadPrivate)
+	premium, err := c.IsPremium()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !premium {
+		t.Errorf("default user isn't premium")
+	}
+}
+
+func TestUsersSharingCache(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	s.AddUser(&spotify.User{ID: "alice", Country: "GB", Product: "premium"})
+	s.AddUser(&spotify.User{ID: "bob", Country: "DE", Product: "free"})
+	opts := s.ClientOptions()
+	opts.CacheStore = spotifytest.NewMemoryCacheStore()
+	s.LogIn("alice")
+	alice := userClient(t, s, opts, spotify.ScopeUserReadPrivate)
+	s.LogIn("bob")
+	bob := userClient(t, s, opts, spotify.ScopeUserReadPrivate)
+	for _, c := range []*spotify.SpotifyClient{alice, bob, alice, bob} {
+		c.UserID()
+	}
+	for c, want := range map[*spotify.SpotifyClient]string{alice: "alice", bob: "bob"} {
+		id, err := c.UserID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("got user id %s, want %s", id, want)
+		}
+		market, err := c.Market()
+		if err != nil {
+			t.Fatal(err)
+		}
+		premium, err := c.IsPremium()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (market == "GB") != (want == "alice") || premium != (want == "alice") {
+			t.Errorf("%s got market %s, premium %t", want, market, premium)
+		}
+	}
+}
+
+func TestMethodScopesIsACopy(t *testing.T) {
+	scopes := spotify.MethodScopes("Market")
+	if len(scopes) != 1 || scopes[0] != spotify.ScopeUserReadPrivate {
+		t.Fatalf("Market needs %v, want %s", scopes, spotify.ScopeUserReadPrivate)
+	}
+	scopes[0] = "nothing"
+	if spotify.MethodScopes("Market")[0] != spotify.ScopeUserReadPrivate {
+		t.Error("changing the returned scopes changed Market's")
+	}
+	if spotify.MethodScopes("GetTrack") != nil {
+		t.Error("GetTrack needs scopes")
+	}
+}
+
+func TestGetUserEscapesID(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	s.AddUser(&spotify.User{ID: "dj/mix ?#1", DisplayName: "DJ"})
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := c.GetUser("dj/mix ?#1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "DJ" {
+		t.Errorf("got user %+v", u)
+	}
+}
+
+func TestCurrentUserFetchedOnce(t *testing.T) {
+	s := spotifytest.NewServer()
+	defer s.Close()
+	c := userClient(t, s, s.ClientOptions(), spotify.ScopeUserReadPrivate)
+	c.UserID()
+	c.Market()
+	c.IsPremium()
+	count := func() int {
+		n := 0
+		for _, req := range s.Requests() {
+			if req == "GET /v1/me" {
+				n += 1
+			}
+		}
+		return n
+	}
+	if count() != 1 {
+		t.Errorf("fetched the current user %d times, want 1", count())
+	}
+	_, err := c.UserIDContext(spotify.WithCacheMode(context.Background(), spotify.CacheModeRefresh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count() != 2 {
+		t.Errorf("fetched the current user %d times after a refresh, want 2", count())
+	}
+}
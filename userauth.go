@@ -0,0 +1,253 @@
+package spotify
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNotAuthorized = errors.New("spotify user has not authorized this client")
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+func (tok *Token) Valid() bool {
+	return tok != nil && tok.AccessToken != "" && tok.Expires.After(time.Now().Add(time.Second))
+}
+
+func (tok *Token) Scopes() []string {
+	if tok == nil {
+		return []string{}
+	}
+	return strings.Fields(tok.Scope)
+}
+
+// UserAuth authenticates requests on behalf of a Spotify user using the
+// authorization code flow.  The user is sent to AuthURL, the code passed
+// back to the redirect URI is handed to Exchange, and from then on the
+// access token is refreshed automatically as it expires.
+type UserAuth struct {
+	clientId string
+	clientSecret string
+	redirectURI string
+	accountsURL string
+	token *Token
+	store TokenStore
+	mutex sync.RWMutex
+	flight tokenFlight
+	client *http.Client
+	log *logger
+}
+
+func NewUserAuth(clientId, clientSecret, redirectURI string) *UserAuth {
+	return &UserAuth{
+		clientId: clientId,
+		clientSecret: clientSecret,
+		redirectURI: redirectURI,
+		accountsURL: spotifyAccountsURL,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		log: newLogger(nil, false),
+	}
+}
+
+func (a *UserAuth) AuthURL(state string, scopes ...string) string {
+	return a.authURL(state, false, scopes, nil)
+}
+
+// AuthURLWithDialog is like AuthURL, but forces the user to approve the
+// app again even if they have already done so.
+func (a *UserAuth) AuthURLWithDialog(state string, scopes ...string) string {
+	return a.authURL(state, true, scopes, nil)
+}
+
+func (a *UserAuth) authURL(state string, showDialog bool, scopes []string, extra url.Values) string {
+	u, err := accountsEndpoint(a.accountsURL, "authorize")
+	if err != nil {
+		u = spotifyAccountsURL + "authorize"
+	}
+	q := url.Values{}
+	q.Set("client_id", a.clientId)
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", a.redirectURI)
+	if state != "" {
+		q.Set("state", state)
+	}
+	if len(scopes) > 0 {
+		q.Set("scope", strings.Join(scopes, " "))
+	}
+	if showDialog {
+		q.Set("show_dialog", "true")
+	}
+	for k, v := range extra {
+		q[k] = v
+	}
+	return u + "?" + q.Encode()
+}
+
+func (a *UserAuth) Exchange(code string) (*Token, error) {
+	q := url.Values{}
+	q.Set("grant_type", "authorization_code")
+	q.Set("code", code)
+	q.Set("redirect_uri", a.redirectURI)
+	return a.fetchToken(q, nil)
+}
+
+// SetAccountsURL points the auth at an alternate accounts service, e.g. a
+// local fake in tests.
+func (a *UserAuth) SetAccountsURL(accountsURL string) {
+	a.accountsURL = accountsURL
+}
+
+// SetHTTPClient replaces the client used for accounts service requests.
+func (a *UserAuth) SetHTTPClient(client *http.Client) {
+	a.client = client
+}
+
+// SetLogger replaces the logger.  Secrets are redacted from messages
+// unless logSecrets is set.
+func (a *UserAuth) SetLogger(l Logger, logSecrets bool) {
+	a.log = newLogger(l, logSecrets)
+}
+
+// Refresh gets a new access token using the refresh token.  Concurrent
+// callers share a single request to the accounts service.
+func (a *UserAuth) Refresh() error {
+	return a.flight.Do(a.refresh)
+}
+
+func (a *UserAuth) refresh() error {
+	tok := a.Token()
+	if tok == nil || tok.RefreshToken == "" {
+		return ErrNotAuthorized
+	}
+	q := url.Values{}
+	q.Set("grant_type", "refresh_token")
+	q.Set("refresh_token", tok.RefreshToken)
+	_, err := a.fetchToken(q, tok)
+	return err
+}
+
+// fetchToken requests a token with q.  When refreshing, prev is the token
+// being replaced, whose refresh token and scope carry over if the response
+// leaves them out.
+func (a *UserAuth) fetchToken(q url.Values, prev *Token) (*Token, error) {
+	now := time.Now()
+	auth, err := requestToken(a.client, a.log, a.accountsURL, a.clientId, a.clientSecret, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spotify user token")
+	}
+	tok := &Token{
+		AccessToken: auth.AccessToken,
+		TokenType: auth.TokenType,
+		RefreshToken: auth.RefreshToken,
+		Scope: auth.Scope,
+		Expires: now.Add(time.Duration(auth.TTL - 1) * time.Second),
+	}
+	// spotify doesn't always repeat the refresh token or scope on refresh
+	if prev != nil {
+		if tok.RefreshToken == "" {
+			tok.RefreshToken = prev.RefreshToken
+		}
+		if tok.Scope == "" {
+			tok.Scope = prev.Scope
+		}
+	}
+	a.SetToken(tok)
+	a.log.Debugf("spotify user auth expires at %s", tok.Expires)
+	a.mutex.RLock()
+	store := a.store
+	a.mutex.RUnlock()
+	if store != nil {
+		// the token is good either way, and failing here would fail every
+		// request waiting on the refresh
+		err = store.Save(tok)
+		if err != nil {
+			a.log.Warnf("can't save spotify user token: %s", err)
+		}
+	}
+	return tok, nil
+}
+
+// UseTokenStore loads any token previously saved in store and saves every
+// token obtained from now on back to it.
+func (a *UserAuth) UseTokenStore(store TokenStore) error {
+	tok, err := store.Load()
+	if err != nil {
+		return errors.Wrap(err, "can't load spotify user token")
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.store = store
+	if tok != nil {
+		a.token = tok
+	}
+	return nil
+}
+
+func (a *UserAuth) Token() *Token {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.token
+}
+
+func (a *UserAuth) SetToken(tok *Token) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.token = tok
+}
+
+// InvalidateToken marks the access token as expired, if it is still the
+// current one, so it gets refreshed before the next request.
+func (a *UserAuth) InvalidateToken(accessToken string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token == nil || a.token.AccessToken != accessToken {
+		return
+	}
+	tok := *a.token
+	tok.Expires = time.Time{}
+	a.token = &tok
+}
+
+func (a *UserAuth) AuthIfNecessary() error {
+	_, err := a.accessToken()
+	return err
+}
+
+func (a *UserAuth) accessToken() (*Token, error) {
+	tok := a.Token()
+	if tok.Valid() {
+		return tok, nil
+	}
+	err := a.flight.Do(func() error {
+		if a.Token().Valid() {
+			return nil
+		}
+		return a.refresh()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.Token(), nil
+}
+
+func (a *UserAuth) AuthenticateRequest(req *http.Request) error {
+	tok, err := a.accessToken()
+	if err != nil {
+		return errors.Wrap(err, "spotify user auth failed")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tok.AccessToken))
+	return nil
+}